@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"connect-text-bot/internal/botconfig_parser"
 	"connect-text-bot/internal/config"
 	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/events"
 	"connect-text-bot/internal/logger"
 	"connect-text-bot/internal/us"
 
@@ -24,6 +26,22 @@ import (
 )
 
 func main() {
+	// подкоманды
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			os.Exit(simulate(os.Args[2:]))
+		case "test":
+			os.Exit(testTranscripts(os.Args[2:]))
+		case "mock":
+			os.Exit(mockServer(os.Args[2:]))
+		case "report":
+			os.Exit(report(os.Args[2:]))
+		case "broadcast":
+			os.Exit(broadcast(os.Args[2:]))
+		}
+	}
+
 	var (
 		cnf = &config.Conf{}
 
@@ -48,20 +66,40 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	cache := database.ConnectInMemoryCache()
-	menus := botconfig_parser.InitLevels(cnf.BotConfig)
+	cache := database.ConnectStateStore(cnf.StateStore)
+	dedup := database.NewDedup(cache, cnf.Dedup)
+
+	if err := events.Init(cnf.EventLog); err != nil {
+		logger.Crit("Ошибка открытия журнала событий", err)
+	}
+	defer events.Close()
+
+	// загружаем конфиги ботов, одни и те же файлы загружаем один раз
+	menus := make(map[string]*botconfig_parser.Levels)
+	for _, line := range cnf.Line {
+		botConfig := cnf.LineBotConfig(line)
+		if _, ok := menus[botConfig]; !ok {
+			menus[botConfig] = botconfig_parser.InitLevels(botConfig)
+		}
+	}
 
-	app := gin.Default()
+	app := gin.New()
+	if err := app.SetTrustedProxies(cnf.Server.TrustedProxies); err != nil {
+		logger.Crit("Некорректный trusted_proxies", err)
+	}
 	app.Use(
+		bot.HookToken(),
+		gin.Logger(),
+		gin.Recovery(),
 		config.Inject("cnf", cnf),
-		database.InjectInMemoryCache("cache", cache),
-		botconfig_parser.InjectLevels("menus", menus),
+		database.InjectStateStore("cache", cache),
+		database.InjectDedup("dedup", dedup),
 		gin.LoggerWithWriter(logFile),
 		us.Inject(cnf.UsServer, cnf.Connect.Login, cnf.Connect.Password),
 		us.InjectMTOM(cnf.UsServer, cnf.Connect.Login, cnf.Connect.Password),
 	)
 
-	bot.InitHooks(app, cnf)
+	bot.InitHooks(app, cnf, menus)
 
 	srv := &http.Server{
 		Addr:    cnf.Server.Listen,
@@ -69,7 +107,13 @@ func main() {
 	}
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cnf.Server.TLSCert != "" {
+			err = srv.ListenAndServeTLS(cnf.Server.TLSCert, cnf.Server.TLSKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf(logger.CritColor("Listen: %s\n"), err)
 		}
 	}()
@@ -98,9 +142,15 @@ func main() {
 					logger.Warning("При таких изменениях конфигурации рекомендуется перезагрузить бота!")
 				}
 				if event.Op&fsnotify.Write == fsnotify.Write {
-					err = menus.UpdateLevels(cnf.BotConfig)
-					if err != nil {
-						logger.Warning("Не корректный конфиг бота!", err)
+					// перечитываем только те конфиги, в папке которых произошло изменение
+					for botConfig, menu := range menus {
+						if !isInDir(event.Name, filepath.Dir(botConfig)) {
+							continue
+						}
+						err = menu.UpdateLevels(botConfig)
+						if err != nil {
+							logger.Warning("Не корректный конфиг бота!", botConfig, err)
+						}
 					}
 				}
 			case err, ok := <-watcher.Errors:
@@ -112,20 +162,25 @@ func main() {
 		}
 	}()
 
-	// ищем все директории в папке
-	var directories []string
-	err = filepath.Walk(path.Dir(cnf.BotConfig), func(path string, info os.FileInfo, err error) error {
+	// ищем все директории в папках конфигов ботов
+	directories := make(map[string]struct{})
+	for botConfig := range menus {
+		err = filepath.Walk(path.Dir(botConfig), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				directories[path] = struct{}{}
+			}
+			return nil
+		})
 		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			directories = append(directories, path)
+			logger.Warning("Не удалось получить список папок для", botConfig, err)
 		}
-		return nil
-	})
+	}
 
 	// устанавливаем триггер на все папки
-	for _, dir := range directories {
+	for dir := range directories {
 		if err := watcher.Add(dir); err != nil {
 			logger.Crit(err)
 		}
@@ -156,6 +211,18 @@ func main() {
 					log.Fatal(logger.CritColor("App forced to shutdown:", err))
 				}
 
+				// дожидаемся обработки принятых событий
+				cnf.Dispatcher.SetDefault()
+				eventsCtx, eventsCancel := context.WithTimeout(context.Background(), cnf.Dispatcher.ShutdownTimeout)
+				if err := bot.StopEvents(eventsCtx); err != nil {
+					logger.Warning("Не дождались обработки событий", err)
+				}
+				eventsCancel()
+
+				if err := cache.Close(); err != nil {
+					logger.Warning("Error while close state store", err)
+				}
+
 				logger.Info("Application stopped correctly!")
 
 				quit <- 0
@@ -169,3 +236,12 @@ func main() {
 
 	os.Exit(code)
 }
+
+// проверить находится ли файл в папке или ее подпапках
+func isInDir(file, dir string) bool {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,284 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"connect-text-bot/internal/cache"
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/connect/messages"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/events"
+	"connect-text-bot/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hooklift/gowsdl/soap"
+)
+
+const (
+	adminUri = "/admin/"
+
+	// сколько ждать выполнения действия администратора в очереди пользователя
+	adminActionTimeout = 2 * time.Minute
+)
+
+type (
+	// краткие данные о состоянии пользователя для списка
+	adminSession struct {
+		UserID       uuid.UUID `json:"user_id"`
+		LineID       uuid.UUID `json:"line_id"`
+		CurrentState string    `json:"curr_state"`
+		Name         string    `json:"name,omitempty"`
+		Surname      string    `json:"surname,omitempty"`
+	}
+
+	// запрос на перевод пользователя в меню
+	adminGotoRequest struct {
+		Menu string `json:"menu" binding:"required"`
+	}
+)
+
+// зарегистрировать API администратора, если в конфиге задан токен
+func initAdmin(app *gin.Engine, cnf config.Admin) error {
+	if cnf.Token == "" {
+		return nil
+	}
+
+	guard, err := adminGuard(cnf)
+	if err != nil {
+		return err
+	}
+
+	admin := app.Group(adminUri, guard)
+	admin.GET("sessions/", adminSessions)
+	admin.GET("sessions/:line_id/:user_id", adminSessionGet)
+	admin.DELETE("sessions/:line_id/:user_id", adminSessionReset)
+	admin.POST("sessions/:line_id/:user_id/goto", adminSessionGoto)
+	admin.POST("broadcast/", adminBroadcast)
+	return nil
+}
+
+// проверить токен и адрес администратора
+func adminGuard(cnf config.Admin) (gin.HandlerFunc, error) {
+	allowed, err := parseAllowedIPs(cnf.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		if len(allowed) != 0 && !ipAllowed(allowed, net.ParseIP(c.ClientIP())) {
+			logger.Warning("Запрос к API администратора с недопустимого адреса", c.ClientIP())
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		// токен принимается только со схемой Bearer
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cnf.Token)) != 1 {
+			logger.Warning("Запрос к API администратора с неверным токеном от", c.ClientIP())
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+	}, nil
+}
+
+// список пользователей с сохраненным состоянием, можно отфильтровать по ?line_id=
+func adminSessions(c *gin.Context) {
+	cacheDB := c.MustGet("cache").(database.StateStore)
+
+	var lineFilter uuid.UUID
+	if line := c.Query("line_id"); line != "" {
+		var err error
+		if lineFilter, err = uuid.Parse(line); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный line_id"})
+			return
+		}
+	}
+
+	keys, err := cacheDB.Keys()
+	if err != nil {
+		logger.Warning("Не удалось получить список состояний", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	sessions := make([]adminSession, 0, len(keys))
+	for _, key := range keys {
+		userID, lineID, ok := cache.ParseStateKey(key)
+		if !ok || (lineFilter != uuid.Nil && lineID != lineFilter) {
+			continue
+		}
+
+		chatState, err := cache.FindState(cacheDB, userID, lineID)
+		if err != nil {
+			// состояние могло быть удалено после получения списка ключей
+			continue
+		}
+		sessions = append(sessions, adminSession{
+			UserID:       userID,
+			LineID:       lineID,
+			CurrentState: chatState.CurrentState,
+			Name:         chatState.User.Name,
+			Surname:      chatState.User.Surname,
+		})
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// полное состояние пользователя: меню, история, переменные, черновик заявки
+func adminSessionGet(c *gin.Context) {
+	cacheDB := c.MustGet("cache").(database.StateStore)
+
+	userID, lineID, ok := adminSessionParams(c)
+	if !ok {
+		return
+	}
+
+	chatState, err := cache.FindState(cacheDB, userID, lineID)
+	if err != nil {
+		if errors.Is(err, database.ErrEntryNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		logger.Warning("Не удалось получить состояние", userID, lineID, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, chatState)
+}
+
+// сбросить состояние пользователя, при следующем сообщении диалог начнется заново
+func adminSessionReset(c *gin.Context) {
+	cacheDB := c.MustGet("cache").(database.StateStore)
+
+	userID, lineID, ok := adminSessionParams(c)
+	if !ok {
+		return
+	}
+
+	err := adminDispatch(c, userID, lineID, func() error {
+		return cache.DeleteState(cacheDB, userID, lineID)
+	})
+	if err != nil {
+		return
+	}
+
+	logger.Info("Администратор сбросил состояние", userID, lineID)
+	c.Status(http.StatusNoContent)
+}
+
+// перевести пользователя в меню и отправить ему это меню
+func adminSessionGoto(c *gin.Context) {
+	cacheDB := c.MustGet("cache").(database.StateStore)
+	dedup := c.MustGet("dedup").(*database.Dedup)
+	soapcl := c.MustGet("soapcl").(*soap.Client)
+	soapclmtom := c.MustGet("soapclmtom").(*soap.Client)
+	cnf := c.MustGet("cnf").(*config.Conf)
+
+	userID, lineID, ok := adminSessionParams(c)
+	if !ok {
+		return
+	}
+
+	var req adminGotoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bot, ok := botsConnect[lineID]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "линия не найдена"})
+		return
+	}
+	if _, ok := bot.menu.Menu[req.Menu]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "меню не найдено"})
+		return
+	}
+
+	md := MultiData{
+		cacheDB:    cacheDB,
+		dedup:      dedup,
+		soapcl:     soapcl,
+		soapclmtom: soapclmtom,
+		cnf:        cnf,
+		menu:       bot.menu,
+		bot:        bot,
+		msg:        messages.Message{LineID: lineID, UserID: userID},
+		events:     eventDispatcher,
+	}
+
+	var newState string
+	err := adminDispatch(c, userID, lineID, func() error {
+		var err error
+		newState, err = gotoMenu(&md, req.Menu, "admin")
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	logger.Info("Администратор перевел пользователя", userID, lineID, "в меню", newState)
+	c.JSON(http.StatusOK, gin.H{"curr_state": newState})
+}
+
+// отправить меню пользователю и сохранить новое состояние, незавершенные действия сбрасываются
+// source - кто перевел пользователя, записывается в журнал событий
+func gotoMenu(md *MultiData, menuID, source string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), adminActionTimeout)
+	defer cancel()
+
+	chatState := cache.GetState(md.bot.connect, ctx, md.cacheDB, md.msg.UserID, md.msg.LineID)
+	md.chatState = &chatState
+	prevState := chatState.CurrentState
+
+	if err := chatState.ClearCacheOmitemptyFields(md.cacheDB, md.msg.UserID, md.msg.LineID); err != nil {
+		return "", err
+	}
+
+	newState, err := SendAnswer(ctx, md, menuID, nil)
+	md.logEvent(events.Event{
+		Type: events.TRANSITION,
+		From: prevState,
+		To:   newState,
+		Text: source,
+	}, err)
+	if err != nil {
+		return "", err
+	}
+
+	return newState, chatState.ChangeCacheState(md.cacheDB, md.msg.UserID, md.msg.LineID, newState)
+}
+
+// выполнить действие в очереди событий пользователя, при ошибке ответ уже отправлен
+func adminDispatch(c *gin.Context, userID, lineID uuid.UUID, action func() error) error {
+	err := eventDispatcher.dispatchWait(c.Request.Context(), userID, lineID, action)
+	if err != nil {
+		logger.Warning("Ошибка выполнения действия администратора", userID, lineID, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errQueueFull) || errors.Is(err, errDispatcherClosed) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+	}
+	return err
+}
+
+// получить id линии и пользователя из адреса
+func adminSessionParams(c *gin.Context) (userID, lineID uuid.UUID, ok bool) {
+	lineID, errLine := uuid.Parse(c.Param("line_id"))
+	userID, errUser := uuid.Parse(c.Param("user_id"))
+	if errLine != nil || errUser != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный line_id или user_id"})
+		return
+	}
+	return userID, lineID, true
+}
@@ -3,37 +3,41 @@ package bot
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"math/rand"
 	"net/http"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"connect-text-bot/internal/botconfig_parser"
 	"connect-text-bot/internal/cache"
 	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/connect/client"
 	"connect-text-bot/internal/connect/messages"
 	"connect-text-bot/internal/connect/requests"
 	"connect-text-bot/internal/connect/response"
 	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/events"
 	"connect-text-bot/internal/logger"
+	"connect-text-bot/internal/metrics"
 	"connect-text-bot/internal/us"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/hooklift/gowsdl/soap"
-	"github.com/kballard/go-shellquote"
 )
 
 type MultiData struct {
-	cacheDB    *bigcache.BigCache
+	cacheDB    database.StateStore
+	dedup      *database.Dedup
 	soapcl     *soap.Client
 	soapclmtom *soap.Client
 	cnf        *config.Conf
@@ -41,14 +45,16 @@ type MultiData struct {
 	bot        Bot
 	msg        messages.Message
 	chatState  *cache.Chat
+	// очередь событий пользователей
+	events *dispatcher
 }
 
 func Receive(c *gin.Context) {
-	cacheDB := c.MustGet("cache").(*bigcache.BigCache)
+	cacheDB := c.MustGet("cache").(database.StateStore)
+	dedup := c.MustGet("dedup").(*database.Dedup)
 	soapcl := c.MustGet("soapcl").(*soap.Client)
 	soapclmtom := c.MustGet("soapclmtom").(*soap.Client)
 	cnf := c.MustGet("cnf").(*config.Conf)
-	menus := c.MustGet("menus").(*botconfig_parser.Levels)
 
 	var msg messages.Message
 	if err := c.BindJSON(&msg); err != nil {
@@ -59,6 +65,7 @@ func Receive(c *gin.Context) {
 	}
 
 	logger.Debug("Receive message:", msg)
+	metrics.EventReceived(msg.MessageType)
 
 	// Реагируем только на сообщения пользователя
 	if (msg.MessageType == messages.MESSAGE_TEXT || msg.MessageType == messages.MESSAGE_FILE) && msg.MessageAuthor != nil && msg.UserID != *msg.MessageAuthor {
@@ -72,37 +79,108 @@ func Receive(c *gin.Context) {
 		return
 	}
 
-	go func() {
-		chatState := cache.GetState(bot.connect, c, cacheDB, msg.UserID, msg.LineID)
-
-		md := MultiData{
-			cacheDB:    cacheDB,
-			soapcl:     soapcl,
-			soapclmtom: soapclmtom,
-			cnf:        cnf,
-			menu:       menus,
-			bot:        bot,
-			msg:        msg,
-			chatState:  &chatState,
-		}
-
-		newState, err := processMessage(&md)
+	// 1С-Коннект может доставить событие повторно, обрабатываем его один раз
+	dedupKey := "message:" + msg.MessageID.String()
+	if msg.MessageID != uuid.Nil {
+		first, err := dedup.Once(dedupKey)
 		if err != nil {
-			logger.Warning("Error processMessage", err)
+			logger.Warning("Не удалось проверить повторную доставку события", msg.MessageID, err)
+		} else if !first {
+			logger.Info("Повторная доставка события", msg.MessageID, "пропущена")
+			c.Status(http.StatusOK)
 			return
 		}
+	}
 
-		err = md.chatState.ChangeCacheState(cacheDB, msg.UserID, msg.LineID, newState)
-		if err != nil {
-			logger.Warning("Error changeState", err)
-		}
+	md := MultiData{
+		cacheDB:    cacheDB,
+		dedup:      dedup,
+		soapcl:     soapcl,
+		soapclmtom: soapclmtom,
+		cnf:        cnf,
+		menu:       bot.menu,
+		bot:        bot,
+		msg:        msg,
+		events:     eventDispatcher,
+	}
 
-		logger.Debug("Cache:", chatState)
-	}()
+	// события пользователя обрабатываются по порядку получения
+	err := md.events.Dispatch(msg.UserID.String()+":"+msg.LineID.String(), func() {
+		processEvent(&md)
+	})
+	if err != nil {
+		logger.Warning("Событие не принято", msg.LineID, msg.UserID, err)
+		// событие не обработано, повторная доставка должна его принять
+		if msg.MessageID != uuid.Nil {
+			_ = dedup.Forget(dedupKey)
+		}
+		c.Status(http.StatusServiceUnavailable)
+		return
+	}
 
 	c.Status(http.StatusOK)
 }
 
+// получить состояние пользователя, обработать событие и сохранить новое состояние
+func processEvent(md *MultiData) {
+	chatState := cache.GetState(md.bot.connect, context.Background(), md.cacheDB, md.msg.UserID, md.msg.LineID)
+	md.chatState = &chatState
+
+	start := time.Now()
+	newState, err := processMessage(md)
+	metrics.ProcessMessage(md.msg.MessageType, time.Since(start))
+	md.logEvent(events.Event{
+		Type:    events.TRANSITION,
+		From:    chatState.CurrentState,
+		To:      newState,
+		Latency: time.Since(start).Milliseconds(),
+	}, err)
+	if err != nil {
+		logger.Warning("Error processMessage", err)
+		return
+	}
+
+	err = md.chatState.ChangeCacheState(md.cacheDB, md.msg.UserID, md.msg.LineID, newState)
+	if err != nil {
+		logger.Warning("Error changeState", err)
+	}
+
+	logger.Debug("Cache:", chatState)
+}
+
+// записать событие в журнал, линия и пользователь берутся из сообщения
+func (md *MultiData) logEvent(e events.Event, err error) {
+	e.LineID, e.UserID = md.msg.LineID, md.msg.UserID
+	if err != nil {
+		e.Error = err.Error()
+	}
+	events.Log(e)
+}
+
+// данные доступные в шаблонах и условиях
+type templateFields struct {
+	User          response.User
+	Var           map[string]string
+	File          map[string]database.File
+	Ticket        database.Ticket
+	CreatedTicket response.Ticket
+}
+
+func templateData(state *cache.Chat) templateFields {
+	var created response.Ticket
+	if state.CreatedTicket != nil {
+		created = *state.CreatedTicket
+	}
+
+	return templateFields{
+		User:          state.User,
+		Var:           state.Vars,
+		File:          state.Files,
+		Ticket:        state.Ticket,
+		CreatedTicket: created,
+	}
+}
+
 // заполнить шаблон данными
 func fillTemplateWithInfo(state *cache.Chat, text string) (result string, err error) {
 	// проверяем есть ли шаблон в тексте чтобы лишний раз не выполнять обработку
@@ -116,20 +194,9 @@ func fillTemplateWithInfo(state *cache.Chat, text string) (result string, err er
 		return
 	}
 
-	// создаем объединенные данные
-	combinedData := struct {
-		User   response.User
-		Var    map[string]string
-		Ticket database.Ticket
-	}{
-		User:   state.User,
-		Var:    state.Vars,
-		Ticket: state.Ticket,
-	}
-
 	// заполняем шаблон
 	var templOutput bytes.Buffer
-	err = templ.Execute(&templOutput, combinedData)
+	err = templ.Execute(&templOutput, templateData(state))
 	if err != nil {
 		return
 	}
@@ -137,6 +204,62 @@ func fillTemplateWithInfo(state *cache.Chat, text string) (result string, err er
 	return templOutput.String(), err
 }
 
+// проверить условие if, пустое условие всегда выполняется
+func checkCondition(state *cache.Chat, cond string) (bool, error) {
+	if cond == "" {
+		return true, nil
+	}
+
+	templ, err := botconfig_parser.ParseCondition(cond)
+	if err != nil {
+		return false, err
+	}
+
+	var templOutput bytes.Buffer
+	err = templ.Execute(&templOutput, templateData(state))
+	if err != nil {
+		return false, err
+	}
+
+	return templOutput.String() == "true", nil
+}
+
+// проверить условие, при ошибке условие считается невыполненным
+func (md *MultiData) checkIf(cond string) bool {
+	ok, err := checkCondition(md.chatState, cond)
+	if err != nil {
+		logger.Warning("Ошибка в условии if:", cond, err)
+		return false
+	}
+	return ok
+}
+
+// показывать ли кнопку пользователю
+func (md *MultiData) buttonVisible(btn *botconfig_parser.Button) bool {
+	now := time.Now()
+	if !md.menu.IsAvailable(btn.AvailableWhen, now) {
+		return false
+	}
+
+	// кнопка ведет в недоступное по расписанию меню, если вне рабочего времени она не ведет в другое
+	if m, ok := md.menu.Menu[btn.Goto]; ok && !md.menu.IsAvailable(m.AvailableWhen, now) {
+		if btn.OffHoursGoto == "" || md.menu.IsWorkingTime(now) {
+			return false
+		}
+	}
+	return md.checkIf(btn.If)
+}
+
+// определить меню для перехода с учетом goto_switch
+func (md *MultiData) buttonGoto(btn *botconfig_parser.Button) string {
+	for _, v := range btn.GotoSwitch {
+		if md.checkIf(v.If) {
+			return v.Goto
+		}
+	}
+	return btn.Goto
+}
+
 // getFileNames - Получить список файлов из папки files.
 func getFileNames(root string) map[string]bool {
 	files := make(map[string]bool)
@@ -202,6 +325,11 @@ func SendAnswerMenuFile(ctx context.Context, md *MultiData, answer *botconfig_pa
 func SendAnswerMenu(ctx context.Context, md *MultiData, answer []*botconfig_parser.Answer, keyboard *[][]requests.KeyboardKey) error {
 	var toSend *[][]requests.KeyboardKey
 
+	// пропускаем сообщения, условие которых не выполнено
+	answer = slices.DeleteFunc(slices.Clone(answer), func(a *botconfig_parser.Answer) bool {
+		return !md.checkIf(a.If)
+	})
+
 	for i := range len(answer) {
 		// Отправляем клаву только с последним сообщением.
 		// Т.к в дп4 криво отображается.
@@ -220,24 +348,52 @@ func SendAnswerMenu(ctx context.Context, md *MultiData, answer []*botconfig_pars
 
 // отобразить меню и выполнить do_button если есть
 func SendAnswer(ctx context.Context, md *MultiData, goTo string, err error) (string, error) {
-	errMenu := SendAnswerMenu(ctx, md, md.menu.Menu[goTo].Answer, md.menu.GenKeyboard(goTo))
+	// вне рабочего времени показываем другое меню
+	if m, ok := md.menu.Menu[goTo]; ok && m.OffHoursGoto != "" && !md.menu.IsWorkingTime(time.Now()) {
+		goTo = m.OffHoursGoto
+	}
+
+	errMenu := SendAnswerMenu(ctx, md, md.menu.Menu[goTo].Answer, md.menu.GenKeyboard(goTo, md.buttonVisible))
 	if errMenu != nil {
 		return finalSend(ctx, md, "", err)
 	}
 
 	// выполнить действие do_button если не было ошибок и есть такая настройка
-	if err == nil && md.menu.Menu[goTo].DoButton != nil {
-		if md.menu.Menu[goTo].DoButton.NestedMenu != nil {
-			return SendAnswer(ctx, md, md.menu.Menu[goTo].DoButton.NestedMenu.ID, err)
+	doButton := md.menu.Menu[goTo].DoButton
+	if err == nil && doButton != nil && md.menu.IsAvailable(doButton.AvailableWhen, time.Now()) {
+		if doButton.NestedMenu != nil {
+			return SendAnswer(ctx, md, doButton.NestedMenu.ID, err)
 		}
 
-		gt, err := triggerButton(ctx, md, md.menu.Menu[goTo].DoButton)
+		gt, err := triggerButton(ctx, md, doButton)
 		_ = md.chatState.HistoryStateAppend(md.cacheDB, md.msg.UserID, md.msg.LineID, gt)
 		return gt, err
 	}
 	return goTo, err
 }
 
+// перевести обращение на специалиста, если свободных специалистов нет - выполнить no_specialists
+func redirectTreatment(ctx context.Context, md *MultiData, btn *botconfig_parser.Button) (string, error) {
+	if noSpecialists := md.menu.NoSpecialists; noSpecialists != nil && btn != noSpecialists {
+		specIDs, err := md.bot.connect.GetSpecialistsAvailable(ctx)
+		if err != nil {
+			logger.Warning("Не удалось получить список свободных специалистов", err)
+		} else if len(specIDs) == 0 {
+			return triggerButton(ctx, md, noSpecialists)
+		}
+	}
+
+	err := md.bot.connect.RerouteTreatment(ctx, md.msg.UserID)
+	return database.GREETINGS, err
+}
+
+// ключ защиты от повторной регистрации: пользователь, линия, черновик и содержимое заявки
+func ticketIdempotencyKey(msg messages.Message, ticket database.Ticket) string {
+	data, _ := json.Marshal(ticket)
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("ticket:%s:%s:%s:%x", msg.UserID, msg.LineID, ticket.DraftID, sum[:16])
+}
+
 // переход на следующую стадию формирования заявки
 func nextStageTicketButton(ctx context.Context, md *MultiData, button *botconfig_parser.TicketButton, nextVar string) (string, error) {
 	ticket := database.Ticket{}
@@ -398,6 +554,10 @@ func nextStageTicketButton(ctx context.Context, md *MultiData, button *botconfig
 					if err != nil {
 						return finalSend(ctx, md, "", err)
 					}
+					err = chatState.ChangeCacheTicketFields(md.cacheDB, msg.UserID, msg.LineID, t.AdditionalFields)
+					if err != nil {
+						return finalSend(ctx, md, "", err)
+					}
 					isFind = true
 					break
 				}
@@ -407,7 +567,7 @@ func nextStageTicketButton(ctx context.Context, md *MultiData, button *botconfig
 			}
 
 			// переходим к следующее шагу
-			nextVar = ticket.GetFinal()
+			nextVar = nextTicketStage(button, chatState.Ticket, nextVar)
 		} else {
 			// формируем клавиатуру
 			kindTypes, err := bot.connect.GetTicketDataTypesWhereKind(ctx, nil, chatState.User.CounterpartOwnerID, chatState.Ticket.Service.ID)
@@ -421,6 +581,77 @@ func nextStageTicketButton(ctx context.Context, md *MultiData, button *botconfig
 			*keyboard = append(*keyboard, btnCancel)
 		}
 	}
+	// дополнительные поля выбранного типа услуги
+	if field, ok := chatState.Ticket.FieldByStage(nextVar); ok {
+		text = field.Name
+		if button.Data.Fields.Text != "" {
+			text = button.Data.Fields.Text + "\n" + field.Name
+		}
+
+		// формируем клавиатуру
+		if !button.Data.Fields.Required {
+			*keyboard = append(*keyboard, btnSkip)
+		}
+		*keyboard = append(*keyboard, btnBack)
+		*keyboard = append(*keyboard, btnCancel)
+	}
+	if nextVar == ticket.GetPriority() {
+		text = button.Data.Priority.Text
+		if button.Data.Priority.DefaultValue != nil {
+			// присвоить значение по умолчанию
+			err := chatState.ChangeCacheTicket(md.cacheDB, msg.UserID, msg.LineID, nextVar, database.TicketPart{Name: button.Data.Priority.DefaultValue})
+			if err != nil {
+				return finalSend(ctx, md, "", err)
+			}
+
+			// переходим к следующее шагу
+			nextVar = nextTicketStage(button, chatState.Ticket, nextVar)
+		} else {
+			// формируем клавиатуру
+			for _, p := range database.TicketPriorities {
+				*keyboard = append(*keyboard, []requests.KeyboardKey{{Text: p.Name}})
+			}
+			if !button.Data.Priority.Required {
+				*keyboard = append(*keyboard, btnSkip)
+			}
+			*keyboard = append(*keyboard, btnBack)
+			*keyboard = append(*keyboard, btnCancel)
+		}
+	}
+	if nextVar == ticket.GetDeadline() {
+		text = button.Data.Deadline.Text
+		var deadline time.Time
+		var err error
+		if button.Data.Deadline.DefaultValue != nil {
+			deadline, err = botconfig_parser.ParseDeadline(*button.Data.Deadline.DefaultValue, time.Now())
+			if err != nil {
+				return finalSend(ctx, md, "", err)
+			}
+
+			// прошедшую дату не подставляем, срок вводит пользователь
+			if deadline.Before(time.Now()) {
+				logger.Warning("Срок заявки по умолчанию уже прошел", *button.Data.Deadline.DefaultValue)
+				deadline = time.Time{}
+			}
+		}
+		if !deadline.IsZero() {
+			// присвоить значение по умолчанию
+			err = chatState.ChangeCacheTicketDeadline(md.cacheDB, msg.UserID, msg.LineID, deadline)
+			if err != nil {
+				return finalSend(ctx, md, "", err)
+			}
+
+			// переходим к следующее шагу
+			nextVar = nextTicketStage(button, chatState.Ticket, nextVar)
+		} else {
+			// формируем клавиатуру
+			if !button.Data.Deadline.Required {
+				*keyboard = append(*keyboard, btnSkip)
+			}
+			*keyboard = append(*keyboard, btnBack)
+			*keyboard = append(*keyboard, btnCancel)
+		}
+	}
 	if nextVar == ticket.GetFinal() {
 		text = button.TicketInfo
 		*keyboard = append(*keyboard, btnConfirm)
@@ -441,39 +672,69 @@ func nextStageTicketButton(ctx context.Context, md *MultiData, button *botconfig
 	return database.CREATE_TICKET, err
 }
 
-// возврат на предыдущий шаг формирования заявки
-func prevStageTicketButton(ctx context.Context, md *MultiData, button *botconfig_parser.TicketButton, currentVar string) (string, error) {
+// шаг формирования заявки и значение по умолчанию, шаги со значением по умолчанию пропускаются
+type ticketStage struct {
+	name         string
+	defaultValue *string
+}
+
+// шаги формирования заявки по порядку, дополнительные поля зависят от выбранного типа услуги
+func ticketStages(button *botconfig_parser.TicketButton, ticket database.Ticket) []ticketStage {
 	t := database.Ticket{}
 
-	var stages = []struct {
-		getCurrent   func() string
-		getNext      func() string
-		defaultValue *string
-	}{
-		{t.GetFinal, t.GetServiceType, button.Data.ServiceType.DefaultValue},
-		{t.GetServiceType, t.GetService, button.Data.Service.DefaultValue},
-		{t.GetService, t.GetExecutor, button.Data.Executor.DefaultValue},
-		{t.GetExecutor, t.GetDescription, button.Data.Description.DefaultValue},
-		{t.GetDescription, t.GetTheme, button.Data.Theme.DefaultValue},
-	}
-
-	for _, stage := range stages {
-		if currentVar == stage.getCurrent() {
-			currentVar = stage.getNext()
-			if stage.defaultValue == nil {
-				return nextStageTicketButton(ctx, md, button, currentVar)
-			}
+	stages := []ticketStage{
+		{t.GetTheme(), button.Data.Theme.DefaultValue},
+		{t.GetDescription(), button.Data.Description.DefaultValue},
+		{t.GetExecutor(), button.Data.Executor.DefaultValue},
+		{t.GetService(), button.Data.Service.DefaultValue},
+		{t.GetServiceType(), button.Data.ServiceType.DefaultValue},
+	}
+	if button.Data.Fields != nil {
+		for _, f := range ticket.Fields {
+			stages = append(stages, ticketStage{t.GetField(f.ID), nil})
 		}
 	}
+	if button.Data.Priority != nil {
+		stages = append(stages, ticketStage{t.GetPriority(), button.Data.Priority.DefaultValue})
+	}
+	if button.Data.Deadline != nil {
+		stages = append(stages, ticketStage{t.GetDeadline(), button.Data.Deadline.DefaultValue})
+	}
 
-	if currentVar == t.GetTheme() {
-		// чистим данные
-		err := md.chatState.ClearCacheOmitemptyFields(md.cacheDB, md.msg.UserID, md.msg.LineID)
+	return append(stages, ticketStage{t.GetFinal(), nil})
+}
 
-		return SendAnswer(ctx, md, md.chatState.PreviousState, err)
+// следующий шаг формирования заявки
+func nextTicketStage(button *botconfig_parser.TicketButton, ticket database.Ticket, currentVar string) string {
+	stages := ticketStages(button, ticket)
+	for i, stage := range stages[:len(stages)-1] {
+		if stage.name == currentVar {
+			return stages[i+1].name
+		}
 	}
+	return ticket.GetFinal()
+}
+
+// возврат на предыдущий шаг формирования заявки
+func prevStageTicketButton(ctx context.Context, md *MultiData, button *botconfig_parser.TicketButton, currentVar string) (string, error) {
+	stages := ticketStages(button, md.chatState.Ticket)
 
-	return finalSend(ctx, md, "", errors.New("не найдено куда направить пользователя по кнопке Назад"))
+	current := slices.IndexFunc(stages, func(stage ticketStage) bool { return stage.name == currentVar })
+	if current == -1 {
+		return finalSend(ctx, md, "", errors.New("не найдено куда направить пользователя по кнопке Назад"))
+	}
+
+	// возвращаемся на ближайший шаг без значения по умолчанию
+	for i := current - 1; i >= 0; i-- {
+		if stages[i].defaultValue == nil {
+			return nextStageTicketButton(ctx, md, button, stages[i].name)
+		}
+	}
+
+	// чистим данные
+	err := md.chatState.ClearCacheOmitemptyFields(md.cacheDB, md.msg.UserID, md.msg.LineID)
+
+	return SendAnswer(ctx, md, md.chatState.PreviousState, err)
 }
 
 // Проверить нажата ли BackButton
@@ -494,8 +755,6 @@ func getGoToIfClickedBackBtn(btn *botconfig_parser.Button, md *MultiData, ignore
 
 // обработать событие произошедшее в чате
 func processMessage(md *MultiData) (string, error) {
-	time.Sleep(250 * time.Millisecond)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
@@ -525,8 +784,12 @@ func processMessage(md *MultiData) (string, error) {
 		return database.GREETINGS, err
 
 	case messages.MESSAGE_NO_FREE_SPECIALISTS:
-		err = bot.connect.RerouteTreatment(ctx, msg.UserID)
 		_ = chatState.HistoryStateClear(md.cacheDB, msg.UserID, msg.LineID)
+		// если no_specialists ставит в очередь, то просто оставляем обращение в очереди
+		if menu.NoSpecialists != nil && !menu.NoSpecialists.RedirectButton {
+			return triggerButton(ctx, md, menu.NoSpecialists)
+		}
+		err = bot.connect.RerouteTreatment(ctx, msg.UserID)
 		return database.GREETINGS, err
 
 	// Пользователь отправил сообщение.
@@ -557,7 +820,7 @@ func processMessage(md *MultiData) (string, error) {
 
 		// пользователь попадет сюда в случае регистрации заявки
 		case database.CREATE_TICKET:
-			btn := GetClickedButton(menu, chatState.CurrentState, text)
+			btn := GetClickedButton(menu, chatState.CurrentState, text, md.buttonVisible)
 			tBtn := chatState.GetCacheSavedButton().TicketButton
 			ticket := database.Ticket{}
 
@@ -589,6 +852,20 @@ func processMessage(md *MultiData) (string, error) {
 				return prevStageTicketButton(ctx, md, tBtn, varName)
 			}
 
+			// файл на шаге темы или описания прикрепляется к заявке, шаг не меняется
+			if msg.MessageType == messages.MESSAGE_FILE && (varName == ticket.GetTheme() || varName == ticket.GetDescription()) {
+				if file, ok := allowedMessageFile(msg, tBtn.Files); ok {
+					err = chatState.ChangeCacheTicketFile(md.cacheDB, msg.UserID, msg.LineID, file)
+					if err != nil {
+						return finalSend(ctx, md, "", err)
+					}
+					_ = bot.connect.Send(ctx, msg.UserID, tBtn.FileAddedText, nil)
+				} else {
+					_ = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.FileNotAllowed, nil)
+				}
+				return nextStageTicketButton(ctx, md, tBtn, varName)
+			}
+
 			switch varName {
 			case ticket.GetTheme(), ticket.GetDescription():
 				textForSave := msg.Text
@@ -665,8 +942,12 @@ func processMessage(md *MultiData) (string, error) {
 								if err != nil {
 									return finalSend(ctx, md, "", err)
 								}
+								err = chatState.ChangeCacheTicketFields(md.cacheDB, msg.UserID, msg.LineID, v.AdditionalFields)
+								if err != nil {
+									return finalSend(ctx, md, "", err)
+								}
 
-								return nextStageTicketButton(ctx, md, tBtn, ticket.GetFinal())
+								return nextStageTicketButton(ctx, md, tBtn, nextTicketStage(tBtn, chatState.Ticket, varName))
 							}
 						}
 					}
@@ -676,6 +957,66 @@ func processMessage(md *MultiData) (string, error) {
 					return database.CREATE_TICKET, err
 				}
 
+			case ticket.GetPriority():
+				priority := ""
+				// если кнопка перехода к следующему шагу
+				if btn != nil && btn.Goto == database.CREATE_TICKET {
+					if tBtn.Data.Priority.Required {
+						err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.StepCannotBeSkipped, nil)
+						return database.CREATE_TICKET, err
+					}
+				} else if priority = database.TicketPriorityID(msg.Text); priority == "" {
+					err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.ReceivedIncorrectValue, nil)
+					return database.CREATE_TICKET, err
+				}
+
+				err = chatState.ChangeCacheTicket(md.cacheDB, msg.UserID, msg.LineID, varName, database.TicketPart{Name: &priority})
+				if err != nil {
+					return finalSend(ctx, md, "", err)
+				}
+				return nextStageTicketButton(ctx, md, tBtn, nextTicketStage(tBtn, chatState.Ticket, varName))
+
+			case ticket.GetDeadline():
+				var deadline time.Time
+				// если кнопка перехода к следующему шагу
+				if btn != nil && btn.Goto == database.CREATE_TICKET {
+					if tBtn.Data.Deadline.Required {
+						err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.StepCannotBeSkipped, nil)
+						return database.CREATE_TICKET, err
+					}
+				} else {
+					// срок в прошлом не принимаем
+					deadline, err = botconfig_parser.ParseDeadline(msg.Text, time.Now())
+					if err != nil || deadline.Before(time.Now()) {
+						err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.ReceivedIncorrectValue, nil)
+						return database.CREATE_TICKET, err
+					}
+				}
+
+				err = chatState.ChangeCacheTicketDeadline(md.cacheDB, msg.UserID, msg.LineID, deadline)
+				if err != nil {
+					return finalSend(ctx, md, "", err)
+				}
+				return nextStageTicketButton(ctx, md, tBtn, nextTicketStage(tBtn, chatState.Ticket, varName))
+
+			// дополнительные поля выбранного типа услуги
+			case ticket.GetField(strings.TrimPrefix(varName, database.TICKET_FIELD_PREFIX)):
+				textForSave := msg.Text
+				// если кнопка перехода к следующему шагу
+				if btn != nil && btn.Goto == database.CREATE_TICKET {
+					if tBtn.Data.Fields.Required {
+						err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.StepCannotBeSkipped, nil)
+						return database.CREATE_TICKET, err
+					}
+					textForSave = ""
+				}
+
+				err = chatState.ChangeCacheTicket(md.cacheDB, msg.UserID, msg.LineID, varName, database.TicketPart{Name: &textForSave})
+				if err != nil {
+					return finalSend(ctx, md, "", err)
+				}
+				return nextStageTicketButton(ctx, md, tBtn, nextTicketStage(tBtn, chatState.Ticket, varName))
+
 			// этап регистрации заявки
 			case ticket.GetFinal():
 				if btn != nil && btn.Goto == database.CREATE_TICKET {
@@ -685,21 +1026,45 @@ func processMessage(md *MultiData) (string, error) {
 						return finalSend(ctx, md, "", err)
 					}
 
+					// одну и ту же заявку регистрируем один раз, даже если кнопку нажали повторно
+					ticketKey := ticketIdempotencyKey(msg, chatState.GetCacheTicket())
+					if first, err := md.dedup.Once(ticketKey); err != nil {
+						logger.Warning("Не удалось проверить повторную регистрацию заявки", err)
+					} else if !first {
+						_ = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.AlreadyRegistered, nil)
+						err = chatState.ClearCacheOmitemptyFields(md.cacheDB, msg.UserID, msg.LineID)
+						return SendAnswer(ctx, md, tBtn.Goto, err)
+					}
+
 					_ = bot.connect.Send(ctx, msg.UserID, "Заявка регистрируется, ожидайте...", nil)
 
 					// регистрируем заявку
+					start := time.Now()
 					r, err := us.CreateTicket(ctx, md.soapcl, msg.UserID, msg.LineID, chatState.GetCacheTicket())
+					md.logEvent(events.Event{Type: events.TICKET, Text: r["ServiceRequestID"], Latency: time.Since(start).Milliseconds()}, err)
+					metrics.TicketCreated(err)
 					if err != nil {
+						// заявка не зарегистрирована, повторная попытка допустима
+						_ = md.dedup.Forget(ticketKey)
 						return finalSend(ctx, md, "", err)
 					}
 
-					// даем время чтобы загрузилась заявка
-					for range 10 {
-						time.Sleep(4 * time.Second)
+					ticketID := uuid.MustParse(r["ServiceRequestID"])
+					attachTicketFiles(ctx, md, tBtn, ticketID)
 
-						_, err := bot.connect.GetTicket(ctx, uuid.MustParse(r["ServiceRequestID"]))
-						if err == nil {
-							break
+					// заявка появляется в 1С-Коннект не сразу, если еще не загрузилась то ждем ее в фоне
+					if created, err := bot.connect.GetTicket(ctx, ticketID); err == nil {
+						err = ticketCreated(ctx, md, tBtn, created)
+						if err != nil {
+							logger.Warning("Не удалось сообщить о регистрации заявки", ticketID, err)
+						}
+					} else {
+						waitMd := *md
+						err = md.events.Go(func(ctx context.Context) {
+							waitCreatedTicket(ctx, waitMd, tBtn, ticketID)
+						})
+						if err != nil {
+							logger.Warning("Не удалось дождаться загрузки заявки", ticketID, err)
 						}
 					}
 
@@ -713,14 +1078,112 @@ func processMessage(md *MultiData) (string, error) {
 			err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketButton.ExpectedButtonPress, nil)
 			return database.CREATE_TICKET, err
 
+		// пользователь попадет сюда при выборе заявки из списка my_tickets_button
+		case database.MY_TICKETS:
+			return myTicketsSelect(ctx, md, text)
+
+		// пользователь попадет сюда при отправке сообщений в заявку ticket_comment_button
+		case database.TICKET_COMMENT:
+			return ticketCommentReceive(ctx, md, text)
+
 		// пользователь попадет сюда в случае перехода в режим ожидания сообщения
 		case database.WAIT_SEND:
 			state := cache.GetState(bot.connect, ctx, md.cacheDB, msg.UserID, msg.LineID)
 
-			// записываем введенные данные в переменную
+			// переходим если нажата BackButton
+			btn := GetClickedButton(menu, chatState.CurrentState, text, md.buttonVisible)
+			goTo := getGoToIfClickedBackBtn(btn, md, true)
+			if goTo != "" {
+				err = chatState.ClearCacheOmitemptyFields(md.cacheDB, msg.UserID, msg.LineID)
+				return SendAnswer(ctx, md, goTo, err)
+			}
+
+			// кнопка save_to_var, которая запустила ожидание ввода
+			if state.SavedButton == nil || state.SavedButton.SaveToVar == nil {
+				return finalSend(ctx, md, "", fmt.Errorf("не найдена кнопка save_to_var для ожидания ввода"))
+			}
+			saveToVar := state.SavedButton.SaveToVar
+
+			// показываем следующую страницу вариантов options_source
+			if source := saveToVar.OptionsSource; source != nil && msg.MessageType == messages.MESSAGE_TEXT &&
+				text == strings.ToLower(source.MoreText) && len(chatState.Options) > source.PageSize {
+				err = chatState.ChangeCacheOptions(md.cacheDB, msg.UserID, msg.LineID, chatState.Options, nextOptionsPage(chatState, source))
+				if err != nil {
+					return finalSend(ctx, md, "", err)
+				}
+				err = sendSaveToVarPrompt(ctx, md, saveToVar)
+				if err != nil {
+					return finalSend(ctx, md, "", err)
+				}
+				return database.WAIT_SEND, nil
+			}
+
+			// файл принимаем только если save_to_var настроен на файлы
+			isFile := msg.MessageType == messages.MESSAGE_FILE && saveToVar.Files != nil
+			if isFile {
+				if _, ok := allowedMessageFile(msg, saveToVar.Files); !ok {
+					keyboard, _, err := saveToVarKeyboard(md, saveToVar)
+					if err != nil {
+						return finalSend(ctx, md, "", err)
+					}
+					err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.SaveToVar.FileNotAllowed, keyboard)
+					return database.WAIT_SEND, err
+				}
+			}
+
+			// проверяем введенные данные
+			if len(saveToVar.Validate) != 0 && !isFile {
+				keyboard, options, err := saveToVarKeyboard(md, saveToVar)
+				if err != nil {
+					return finalSend(ctx, md, "", err)
+				}
+
+				for _, rule := range saveToVar.Validate {
+					if rule.Validate(msg.Text, options) {
+						continue
+					}
+
+					failedInputs := chatState.FailedInputs + 1
+					if rule.RetryLimit != 0 && failedInputs >= rule.RetryLimit {
+						_ = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.SaveToVar.RetryLimitExceeded, nil)
+
+						err = chatState.ClearCacheOmitemptyFields(md.cacheDB, msg.UserID, msg.LineID)
+						goTo := database.FINAL
+						if saveToVar.FailGoto != "" {
+							goTo = saveToVar.FailGoto
+						}
+						return SendAnswer(ctx, md, goTo, err)
+					}
+					_ = chatState.ChangeCacheFailedInputs(md.cacheDB, msg.UserID, msg.LineID, failedInputs)
+
+					// сообщаем об ошибке и ждем повторного ввода
+					errorText := menu.ErrorMessages.SaveToVar.ReceivedIncorrectValue
+					if rule.ErrorText != "" {
+						errorText, err = fillTemplateWithInfo(chatState, rule.ErrorText)
+						if err != nil {
+							return finalSend(ctx, md, "", err)
+						}
+					}
+					err = bot.connect.Send(ctx, msg.UserID, errorText, keyboard)
+					return database.WAIT_SEND, err
+				}
+			}
+
+			// записываем введенные данные или файл в переменную
 			varName, ok := chatState.GetCacheVar(database.VAR_FOR_SAVE)
 			if ok && varName != "" {
-				_ = chatState.ChangeCacheVars(md.cacheDB, msg.UserID, msg.LineID, varName, msg.Text)
+				if isFile {
+					file, _ := messageFile(msg)
+					_ = chatState.ChangeCacheFile(md.cacheDB, msg.UserID, msg.LineID, varName, file)
+				} else {
+					// для варианта options_source сохраняется его значение
+					value := msg.Text
+					if option, ok := findOption(chatState.Options, text); ok && saveToVar.OptionsSource != nil {
+						value = option.Value
+					}
+					_ = chatState.ChangeCacheVars(md.cacheDB, msg.UserID, msg.LineID, varName, value)
+					_ = chatState.DeleteCacheFile(md.cacheDB, msg.UserID, msg.LineID, varName)
+				}
 			}
 
 			// чистим необязательные поля
@@ -729,15 +1192,8 @@ func processMessage(md *MultiData) (string, error) {
 				return finalSend(ctx, md, "", err)
 			}
 
-			// переходим если нажата BackButton
-			btn := GetClickedButton(menu, chatState.CurrentState, text)
-			goTo := getGoToIfClickedBackBtn(btn, md, true)
-			if goTo != "" {
-				return SendAnswer(ctx, md, goTo, err)
-			}
-
 			// выполнить действие кнопки
-			gt, err := triggerButton(ctx, md, state.SavedButton)
+			gt, err := triggerButton(ctx, md, saveToVar.DoButton)
 			_ = chatState.HistoryStateAppend(md.cacheDB, msg.UserID, msg.LineID, gt)
 			return gt, err
 
@@ -748,14 +1204,16 @@ func processMessage(md *MultiData) (string, error) {
 			cm, ok := menu.Menu[currentMenu]
 			if !ok {
 				logger.Warning("неизвестное состояние: ", currentMenu)
-				err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.CommandUnknown, menu.GenKeyboard(database.START))
+				err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.CommandUnknown, menu.GenKeyboard(database.START, md.buttonVisible))
 				return database.GREETINGS, err
 			}
 
 			// определяем какая кнопка была нажата
-			btn := GetClickedButton(menu, currentMenu, text)
+			btn := GetClickedButton(menu, currentMenu, text, md.buttonVisible)
 
 			if btn != nil {
+				md.logEvent(events.Event{Type: events.BUTTON, From: currentMenu, ButtonID: btn.ButtonID}, nil)
+				metrics.ButtonTriggered(currentMenu, btn.ButtonID)
 				gt, err := triggerButton(ctx, md, btn)
 				_ = chatState.HistoryStateAppend(md.cacheDB, msg.UserID, msg.LineID, gt)
 				return gt, err
@@ -763,7 +1221,8 @@ func processMessage(md *MultiData) (string, error) {
 				if !cm.QnaDisable && menu.UseQNA.Enabled {
 					return qnaResponse(ctx, md, currentMenu)
 				}
-				err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.CommandUnknown, menu.GenKeyboard(currentMenu))
+				md.logEvent(events.Event{Type: events.UNKNOWN_COMMAND, From: currentMenu, Text: msg.Text}, nil)
+				err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.CommandUnknown, menu.GenKeyboard(currentMenu, md.buttonVisible))
 				return chatState.CurrentState, err
 			}
 		}
@@ -782,6 +1241,9 @@ func qnaResponse(ctx context.Context, md *MultiData, currentMenu string) (string
 	// logger.Info("QNA", msg, chatState)
 	qnaText, needClose, requestID, resultID := getMessageFromQNA(ctx, md)
 	if qnaText != "" {
+		md.logEvent(events.Event{Type: events.QNA_HIT, From: currentMenu, Text: md.msg.Text}, nil)
+		metrics.Qna(true)
+
 		// Была подсказка
 		go md.bot.connect.QnaSelected(ctx, requestID, resultID)
 
@@ -791,10 +1253,12 @@ func qnaResponse(ctx context.Context, md *MultiData, currentMenu string) (string
 			return currentMenu, err
 		}
 
-		err = md.bot.connect.Send(ctx, md.msg.UserID, qnaText, md.menu.GenKeyboard(currentMenu))
+		err = md.bot.connect.Send(ctx, md.msg.UserID, qnaText, md.menu.GenKeyboard(currentMenu, md.buttonVisible))
 		return currentMenu, err
 	}
 
+	md.logEvent(events.Event{Type: events.QNA_MISS, From: currentMenu, Text: md.msg.Text}, nil)
+	metrics.Qna(false)
 	return SendAnswer(ctx, md, database.FAIL_QNA, err)
 }
 
@@ -804,10 +1268,15 @@ func triggerButton(ctx context.Context, md *MultiData, btn *botconfig_parser.But
 		return finalSend(ctx, md, "", fmt.Errorf("Кнопка не передана в triggerButton"))
 	}
 
+	// вне рабочего времени вместо действия кнопки переходим в другое меню
+	if btn.OffHoursGoto != "" && !md.menu.IsWorkingTime(time.Now()) {
+		return SendAnswer(ctx, md, btn.OffHoursGoto, nil)
+	}
+
 	var err error
 	chatState, msg, bot, menu, cnf := md.chatState, md.msg, md.bot, md.menu, md.cnf
 
-	goTo := btn.Goto
+	goTo := md.buttonGoto(btn)
 	if gt := getGoToIfClickedBackBtn(btn, md, false); gt != "" {
 		goTo = gt
 	}
@@ -823,8 +1292,7 @@ func triggerButton(ctx context.Context, md *MultiData, btn *botconfig_parser.But
 		return database.GREETINGS, err
 	}
 	if btn.RedirectButton {
-		err = bot.connect.RerouteTreatment(ctx, msg.UserID)
-		return database.GREETINGS, err
+		return redirectTreatment(ctx, md, btn)
 	}
 	if btn.AppointSpecButton != nil && *btn.AppointSpecButton != uuid.Nil {
 		// проверяем доступен ли специалист
@@ -890,79 +1358,75 @@ func triggerButton(ctx context.Context, md *MultiData, btn *botconfig_parser.But
 		return database.GREETINGS, err
 	}
 	if btn.ExecButton != "" {
-		// удаляем пробелы после {{ и до }}
-		for strings.Contains(btn.ExecButton, "{{ ") || strings.Contains(btn.ExecButton, " }}") {
-			btn.ExecButton = strings.ReplaceAll(btn.ExecButton, "{{ ", "{{")
-			btn.ExecButton = strings.ReplaceAll(btn.ExecButton, " }}", "}}")
-		}
-
-		// разбиваем шаблон на части (команда и аргументы) чтобы исключить возможность выйти за кавычки
-		cmdParts, err := shellquote.Split(btn.ExecButton)
+		start := time.Now()
+		cmdOutput, err := execButtonCommand(ctx, md, btn)
+		md.logEvent(events.Event{Type: events.EXEC, From: chatState.CurrentState, ButtonID: btn.ButtonID, Latency: time.Since(start).Milliseconds()}, err)
 		if err != nil {
-			return finalSend(ctx, md, "", err)
-		}
-
-		// заполняем каждую часть шаблона отдельно
-		for k, part := range cmdParts {
-			cmdParts[k], err = fillTemplateWithInfo(chatState, part)
-			if err != nil {
-				return finalSend(ctx, md, "", err)
+			if btn.ExecOptions != nil && btn.ExecOptions.FailGoto != "" {
+				logger.Warning("Error exec_button", err)
+				return SendAnswer(ctx, md, btn.ExecOptions.FailGoto, nil)
 			}
-		}
-
-		// выполняем команду на устройстве
-		cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
-		cmdOutput, err := cmd.CombinedOutput()
-		if err != nil {
-			return finalSend(ctx, md, "Ошибка: "+err.Error(), err)
+			return finalSend(ctx, md, execErrorMessage(md, err), err)
 		}
 
 		// выводим результат и завершаем
-		_ = bot.connect.Send(ctx, msg.UserID, string(cmdOutput), nil)
-		goTo := database.FINAL
-		if btn.Goto != "" {
-			goTo = btn.Goto
+		if cmdOutput != "" {
+			_ = bot.connect.Send(ctx, msg.UserID, cmdOutput, nil)
+		}
+		if goTo == "" {
+			goTo = database.FINAL
 		}
 		return SendAnswer(ctx, md, goTo, err)
 	}
-	if btn.SaveToVar != nil {
-		// настройка клавиатуры
-		keyboard := &[][]requests.KeyboardKey{}
-		for _, v := range btn.SaveToVar.OfferOptions {
-			r, err := fillTemplateWithInfo(chatState, v)
-			if err != nil {
+	if btn.HttpButton != nil {
+		// выполняем запрос и сохраняем данные ответа
+		err = httpButtonRequest(ctx, md, btn.HttpButton)
+		if err != nil {
+			if btn.HttpButton.FailGoto == "" {
 				return finalSend(ctx, md, "", err)
 			}
-			*keyboard = append(*keyboard, []requests.KeyboardKey{{Text: r}})
+			logger.Warning("Error http_button", err)
+			return SendAnswer(ctx, md, btn.HttpButton.FailGoto, nil)
 		}
-		*keyboard = append(*keyboard, *menu.GenKeyboard(database.WAIT_SEND)...)
 
-		// Сообщаем пользователю что требуем и запускаем ожидание данных
-		if btn.SaveToVar.SendText != nil && *btn.SaveToVar.SendText != "" {
-			r, err := fillTemplateWithInfo(chatState, *btn.SaveToVar.SendText)
+		if goTo == "" {
+			goTo = database.FINAL
+		}
+		return SendAnswer(ctx, md, goTo, err)
+	}
+	if btn.SaveToVar != nil {
+		// варианты из внешнего источника получаем один раз, дальше они листаются из кеша
+		if source := btn.SaveToVar.OptionsSource; source != nil {
+			options, err := loadOptions(ctx, md, source)
 			if err != nil {
 				return finalSend(ctx, md, "", err)
 			}
-
-			_ = bot.connect.Send(ctx, msg.UserID, r, keyboard)
-		} else {
-			// выводим default WAIT_SEND меню в случае отсутствия настроек текста
-			err = SendAnswerMenu(ctx, md, menu.Menu[database.WAIT_SEND].Answer, keyboard)
+			err = chatState.ChangeCacheOptions(md.cacheDB, msg.UserID, msg.LineID, options, 0)
 			if err != nil {
 				return finalSend(ctx, md, "", err)
 			}
 		}
 
+		// Сообщаем пользователю что требуем и запускаем ожидание данных
+		err = sendSaveToVarPrompt(ctx, md, btn.SaveToVar)
+		if err != nil {
+			return finalSend(ctx, md, "", err)
+		}
+
 		// сохраняем имя переменной куда будем записывать результат
 		_ = chatState.ChangeCacheVars(md.cacheDB, msg.UserID, msg.LineID, database.VAR_FOR_SAVE, btn.SaveToVar.VarName)
 
-		// сохраняем ссылку на кнопку которая будет выполнена после завершения
-		if btn.SaveToVar.DoButton != nil {
-			err = chatState.ChangeCacheSavedButton(md.cacheDB, msg.UserID, msg.LineID, btn.SaveToVar.DoButton)
-		}
+		// сохраняем кнопку, ее правила проверки и do_button понадобятся после ввода
+		err = chatState.ChangeCacheSavedButton(md.cacheDB, msg.UserID, msg.LineID, btn)
 
 		return database.WAIT_SEND, err
 	}
+	if btn.MyTicketsButton != nil {
+		return myTickets(ctx, md, btn)
+	}
+	if btn.TicketCommentButton != nil {
+		return ticketComment(ctx, md, btn)
+	}
 	if btn.TicketButton != nil {
 		// сохраняем ссылку на кнопку которая была нажата
 		err = chatState.ChangeCacheSavedButton(md.cacheDB, msg.UserID, msg.LineID, btn)
@@ -972,6 +1436,12 @@ func triggerButton(ctx context.Context, md *MultiData, btn *botconfig_parser.But
 
 		t := database.Ticket{}
 
+		// повторная регистрация заявки проверяется в пределах одного черновика
+		err = chatState.ChangeCacheTicketDraft(md.cacheDB, msg.UserID, msg.LineID, uuid.New())
+		if err != nil {
+			return finalSend(ctx, md, "", err)
+		}
+
 		// сохраняем id канала поступления заявки
 		err = chatState.ChangeCacheTicket(md.cacheDB, msg.UserID, msg.LineID, t.GetChannel(), database.TicketPart{ID: btn.TicketButton.ChannelID})
 		if err != nil {
@@ -986,13 +1456,65 @@ func triggerButton(ctx context.Context, md *MultiData, btn *botconfig_parser.But
 	return SendAnswer(ctx, md, goTo, err)
 }
 
+// сообщение с приглашением к вводу и вариантами ответа save_to_var
+func sendSaveToVarPrompt(ctx context.Context, md *MultiData, saveToVar *botconfig_parser.SaveToVar) error {
+	keyboard, _, err := saveToVarKeyboard(md, saveToVar)
+	if err != nil {
+		return err
+	}
+
+	if saveToVar.SendText != nil && *saveToVar.SendText != "" {
+		r, err := fillTemplateWithInfo(md.chatState, *saveToVar.SendText)
+		if err != nil {
+			return err
+		}
+
+		_ = md.bot.connect.Send(ctx, md.msg.UserID, r, keyboard)
+		return nil
+	}
+
+	// выводим default WAIT_SEND меню в случае отсутствия настроек текста
+	return SendAnswerMenu(ctx, md, md.menu.Menu[database.WAIT_SEND].Answer, keyboard)
+}
+
+// клавиатура ожидания ввода и заполненные варианты offer_options и options_source
+func saveToVarKeyboard(md *MultiData, saveToVar *botconfig_parser.SaveToVar) (*[][]requests.KeyboardKey, []string, error) {
+	keyboard := &[][]requests.KeyboardKey{}
+	options := make([]string, 0, len(saveToVar.OfferOptions)+len(md.chatState.Options))
+	for _, v := range saveToVar.OfferOptions {
+		r, err := fillTemplateWithInfo(md.chatState, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		options = append(options, r)
+		*keyboard = append(*keyboard, []requests.KeyboardKey{{Text: r}})
+	}
+	if source := saveToVar.OptionsSource; source != nil {
+		// на клавиатуре только текущая страница, выбрать можно любой вариант
+		page, more := optionsPage(md.chatState, source)
+		for _, v := range page {
+			*keyboard = append(*keyboard, []requests.KeyboardKey{{Text: v.Text}})
+		}
+		if more {
+			*keyboard = append(*keyboard, []requests.KeyboardKey{{Text: source.MoreText}})
+		}
+		for _, v := range md.chatState.Options {
+			options = append(options, v.Text)
+		}
+	}
+	if waitSendKeyboard := md.menu.GenKeyboard(database.WAIT_SEND, md.buttonVisible); waitSendKeyboard != nil {
+		*keyboard = append(*keyboard, *waitSendKeyboard...)
+	}
+	return keyboard, options, nil
+}
+
 // определить какая кнопка была нажата
-func GetClickedButton(menu *botconfig_parser.Levels, currentMenu, text string) (btn *botconfig_parser.Button) {
-	btn = menu.GetButton(currentMenu, text)
+func GetClickedButton(menu *botconfig_parser.Levels, currentMenu, text string, visible func(*botconfig_parser.Button) bool) (btn *botconfig_parser.Button) {
+	btn = menu.GetButton(currentMenu, text, visible)
 	if btn == nil {
 		text = strings.ReplaceAll(text, "«", "\"")
 		text = strings.ReplaceAll(text, "»", "\"")
-		btn = menu.GetButton(currentMenu, text)
+		btn = menu.GetButton(currentMenu, text, visible)
 	}
 	return
 }
@@ -1001,6 +1523,10 @@ func GetClickedButton(menu *botconfig_parser.Levels, currentMenu, text string) (
 func finalSend(ctx context.Context, md *MultiData, finalMsg string, err error) (string, error) {
 	if finalMsg == "" {
 		finalMsg = md.menu.ErrorMessages.ButtonProcessing
+		// временную ошибку 1С-Коннект имеет смысл повторить позже
+		if client.IsTransient(err) {
+			finalMsg = md.menu.ErrorMessages.TemporaryUnavailable
+		}
 	}
 	_ = md.bot.connect.Send(ctx, md.msg.UserID, finalMsg, nil)
 
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"connect-text-bot/internal/botconfig_parser"
 	"connect-text-bot/internal/connect/client"
 
 	"github.com/google/uuid"
@@ -11,7 +12,12 @@ type (
 
 	Bot struct {
 		connect *client.Client
+		// меню бота на линии
+		menu *botconfig_parser.Levels
 	}
 )
 
 var botsConnect = make(fConnect)
+
+// очередь обработки событий от 1С-Коннект
+var eventDispatcher *dispatcher
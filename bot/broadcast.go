@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/connect/messages"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/hooklift/gowsdl/soap"
+)
+
+const (
+	BroadcastUri = adminUri + "broadcast/"
+
+	// статусы получателей рассылки
+	BROADCAST_SENT    = "sent"
+	BROADCAST_ERROR   = "error"
+	BROADCAST_DRY_RUN = "dry_run"
+	// рассылка прервана до отправки получателю
+	BROADCAST_SKIPPED = "skipped"
+)
+
+type (
+	// BroadcastRequest - отправить сообщение, файл или меню списку пользователей линии
+	BroadcastRequest struct {
+		LineID uuid.UUID   `json:"line_id" binding:"required"`
+		Users  []uuid.UUID `json:"users" binding:"required"`
+
+		// текст сообщения
+		Text string `json:"text,omitempty"`
+		// имя файла в files_dir
+		File string `json:"file,omitempty"`
+		// меню, в которое переводится пользователь, отправляется после текста и файла
+		Menu string `json:"menu,omitempty"`
+
+		// только проверить запрос и список получателей, ничего не отправляя
+		DryRun bool `json:"dry_run,omitempty"`
+	}
+
+	// BroadcastResult - результат рассылки для одного получателя
+	BroadcastResult struct {
+		UserID uuid.UUID `json:"user_id"`
+		Status string    `json:"status"`
+		Error  string    `json:"error,omitempty"`
+	}
+
+	// BroadcastReport - результат рассылки по всем получателям
+	BroadcastReport struct {
+		Sent    int               `json:"sent"`
+		Failed  int               `json:"failed"`
+		Results []BroadcastResult `json:"results"`
+	}
+)
+
+// проверить что есть что отправлять, меню и файл существуют
+func (r *BroadcastRequest) validate(bot Bot, filesDir string) error {
+	if r.Text == "" && r.File == "" && r.Menu == "" {
+		return errors.New("не указаны text, file или menu")
+	}
+	if r.Menu != "" {
+		if _, ok := bot.menu.Menu[r.Menu]; !ok {
+			return errors.New("меню не найдено")
+		}
+	}
+	if r.File != "" {
+		if _, _, err := getFileInfo(r.File, filesDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// разослать сообщение пользователям линии с ограничением скорости
+func adminBroadcast(c *gin.Context) {
+	cacheDB := c.MustGet("cache").(database.StateStore)
+	dedup := c.MustGet("dedup").(*database.Dedup)
+	soapcl := c.MustGet("soapcl").(*soap.Client)
+	soapclmtom := c.MustGet("soapclmtom").(*soap.Client)
+	cnf := c.MustGet("cnf").(*config.Conf)
+
+	var req BroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bot, ok := botsConnect[req.LineID]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "линия не найдена"})
+		return
+	}
+	if err := req.validate(bot, cnf.FilesDir); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	md := MultiData{
+		cacheDB:    cacheDB,
+		dedup:      dedup,
+		soapcl:     soapcl,
+		soapclmtom: soapclmtom,
+		cnf:        cnf,
+		menu:       bot.menu,
+		bot:        bot,
+		msg:        messages.Message{LineID: req.LineID},
+		events:     eventDispatcher,
+	}
+
+	logger.Info("Рассылка на линии", req.LineID, "получателей:", len(req.Users), "dry_run:", req.DryRun)
+	report := broadcast(c.Request.Context(), &md, &req, cnf.Admin.BroadcastRate)
+	logger.Info("Рассылка на линии", req.LineID, "завершена, отправлено:", report.Sent, "ошибок:", report.Failed)
+
+	c.JSON(http.StatusOK, report)
+}
+
+// отправить каждому получателю не чаще rate в секунду, повторы в списке получателей пропускаются
+func broadcast(ctx context.Context, md *MultiData, req *BroadcastRequest, rate float64) BroadcastReport {
+	if rate <= 0 {
+		rate = 5
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+
+	report := BroadcastReport{Results: make([]BroadcastResult, 0, len(req.Users))}
+	seen := make(map[uuid.UUID]bool, len(req.Users))
+	for _, userID := range req.Users {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		result := BroadcastResult{UserID: userID, Status: BROADCAST_DRY_RUN}
+		switch {
+		case req.DryRun:
+		case ctx.Err() != nil:
+			result.Status, result.Error = BROADCAST_SKIPPED, ctx.Err().Error()
+		default:
+			userMd := *md
+			userMd.msg.UserID = userID
+			err := md.events.dispatchWait(ctx, userID, md.msg.LineID, func() error {
+				return broadcastTo(ctx, &userMd, req)
+			})
+			if err != nil {
+				logger.Warning("Ошибка рассылки пользователю", userID, err)
+				result.Status, result.Error = BROADCAST_ERROR, err.Error()
+				report.Failed++
+			} else {
+				result.Status = BROADCAST_SENT
+				report.Sent++
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// отправить пользователю текст, файл и меню из рассылки
+func broadcastTo(ctx context.Context, md *MultiData, req *BroadcastRequest) error {
+	if req.Text != "" {
+		if err := md.bot.connect.Send(ctx, md.msg.UserID, req.Text, nil); err != nil {
+			return err
+		}
+	}
+	if req.File != "" {
+		isImage, filePath, err := getFileInfo(req.File, md.cnf.FilesDir)
+		if err != nil {
+			return err
+		}
+		if err := md.bot.connect.SendFile(ctx, md.msg.UserID, isImage, req.File, filePath, nil, nil); err != nil {
+			return err
+		}
+	}
+	if req.Menu != "" {
+		_, err := gotoMenu(md, req.Menu, "broadcast")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"connect-text-bot/internal/config"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errQueueFull        = errors.New("очередь событий заполнена")
+	errDispatcherClosed = errors.New("обработка событий остановлена")
+)
+
+// dispatcher - обрабатывает события одного пользователя строго по очереди, разных пользователей параллельно
+type dispatcher struct {
+	maxPending int
+	// пользователи, у которых есть необработанные события, каждый не больше одного раза
+	ready chan string
+
+	mu      sync.Mutex
+	queues  map[string][]func()
+	pending int
+	closed  bool
+	// принятые события и фоновые задачи
+	wg sync.WaitGroup
+	// обработчики останавливаются один раз, даже если Close вызван повторно
+	stop sync.Once
+
+	// контекст фоновых задач, отменяется при остановке
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newDispatcher(cnf config.Dispatcher) *dispatcher {
+	cnf.SetDefault()
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &dispatcher{
+		maxPending: cnf.QueueSize,
+		// пользователей с событиями не больше, чем принятых событий, поэтому запись не блокируется
+		ready:  make(chan string, cnf.QueueSize),
+		queues: make(map[string][]func()),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for range cnf.Workers {
+		go d.worker()
+	}
+	return d
+}
+
+// Dispatch - поставить событие в очередь пользователя, если очередь заполнена то событие не принимается
+func (d *dispatcher) Dispatch(key string, job func()) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return errDispatcherClosed
+	}
+	if d.pending >= d.maxPending {
+		return errQueueFull
+	}
+
+	d.pending++
+	d.wg.Add(1)
+	queue, active := d.queues[key]
+	d.queues[key] = append(queue, job)
+
+	// события пользователя уже ждут обработчика или обрабатываются, новое будет взято из очереди
+	if !active {
+		d.ready <- key
+	}
+	return nil
+}
+
+// обработать одно событие пользователя и вернуть пользователя в конец очереди,
+// чтобы пользователь с частыми сообщениями не занимал обработчик
+func (d *dispatcher) worker() {
+	for key := range d.ready {
+		d.mu.Lock()
+		queue := d.queues[key]
+		job := queue[0]
+		d.queues[key] = queue[1:]
+		d.mu.Unlock()
+
+		job()
+
+		d.mu.Lock()
+		d.pending--
+		if len(d.queues[key]) == 0 {
+			delete(d.queues, key)
+		} else {
+			d.ready <- key
+		}
+		d.mu.Unlock()
+		d.wg.Done()
+	}
+}
+
+// Go - запустить фоновую задачу, которая не занимает очередь пользователя,
+// при остановке контекст задачи отменяется и ее завершение дожидается Close
+func (d *dispatcher) Go(task func(ctx context.Context)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return errDispatcherClosed
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		task(d.ctx)
+	}()
+	return nil
+}
+
+// Close - перестать принимать события, прервать фоновые задачи и дождаться обработки принятых
+func (d *dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		// новых событий не будет, обработчики завершаются
+		d.stop.Do(func() { close(d.ready) })
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// выполнить действие в очереди событий пользователя и дождаться результата,
+// чтобы действие не пересеклось с обработкой сообщений пользователя
+func (d *dispatcher) dispatchWait(ctx context.Context, userID, lineID uuid.UUID, action func() error) error {
+	// обработка событий еще не запущена
+	if d == nil {
+		return errDispatcherClosed
+	}
+
+	result := make(chan error, 1)
+	err := d.Dispatch(userID.String()+":"+lineID.String(), func() {
+		result <- action()
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err = <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
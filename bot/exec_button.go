@@ -0,0 +1,201 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/logger"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// время ожидания закрытия вывода после остановки команды
+const execWaitDelay = time.Second
+
+// команда остановлена по timeout из exec_options
+var errExecTimeout = errors.New("превышено время выполнения команды")
+
+// переменная с кодом завершения команды, доступна в меню fail_goto
+const execExitCodeVar = "exit_code"
+
+// вывод команды в формате json
+type execJsonOutput struct {
+	// сообщение пользователю
+	Text string `json:"text"`
+	// сохранить в переменные
+	Vars map[string]any `json:"vars"`
+}
+
+// буфер, который хранит не больше limit байт, остальное отбрасывается
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 {
+		if free := b.limit - b.buf.Len(); free < len(p) {
+			_, _ = b.buf.Write(p[:max(free, 0)])
+			return len(p), nil
+		}
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Len() int {
+	return b.buf.Len()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// выполнить команду exec_button и вернуть текст для пользователя
+func execButtonCommand(ctx context.Context, md *MultiData, btn *botconfig_parser.Button) (string, error) {
+	chatState, msg := md.chatState, md.msg
+
+	opts := botconfig_parser.ExecOptions{}
+	if btn.ExecOptions != nil {
+		opts = *btn.ExecOptions
+	}
+
+	output, err := runCommand(ctx, md, btn.ExecButton, opts)
+	if err != nil {
+		// код завершения сохраняем для меню fail_goto
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			_ = chatState.ChangeCacheVars(md.cacheDB, msg.UserID, msg.LineID, execExitCodeVar, strconv.Itoa(exitErr.ExitCode()))
+		}
+		return "", err
+	}
+
+	if opts.Output != botconfig_parser.EXEC_OUTPUT_JSON {
+		return output, nil
+	}
+
+	var result execJsonOutput
+	dec := json.NewDecoder(strings.NewReader(output))
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil {
+		return "", fmt.Errorf("вывод команды не в формате json: %w", err)
+	}
+	for varName, value := range result.Vars {
+		if varName == database.VAR_FOR_SAVE {
+			continue
+		}
+		err = chatState.ChangeCacheVars(md.cacheDB, msg.UserID, msg.LineID, varName, jsonValueString(value))
+		if err != nil {
+			return "", err
+		}
+	}
+	return result.Text, nil
+}
+
+// выполнить команду с шаблонами в аргументах и вернуть вывод,
+// при выводе json stderr не попадает в вывод, а пишется в лог
+func runCommand(ctx context.Context, md *MultiData, command string, opts botconfig_parser.ExecOptions) (string, error) {
+	// удаляем пробелы после {{ и до }}
+	for strings.Contains(command, "{{ ") || strings.Contains(command, " }}") {
+		command = strings.ReplaceAll(command, "{{ ", "{{")
+		command = strings.ReplaceAll(command, " }}", "}}")
+	}
+
+	// разбиваем шаблон на части (команда и аргументы) чтобы исключить возможность выйти за кавычки
+	cmdParts, err := shellquote.Split(command)
+	if err != nil {
+		return "", err
+	}
+
+	// заполняем каждую часть шаблона отдельно
+	for k, part := range cmdParts {
+		cmdParts[k], err = fillTemplateWithInfo(md.chatState, part)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// выполняем команду на устройстве
+	cmd := exec.CommandContext(ctx, cmdParts[0], cmdParts[1:]...)
+	cmd.Dir = opts.WorkDir
+	// не ждем дочерние процессы, которые держат вывод после завершения команды по таймауту
+	cmd.WaitDelay = execWaitDelay
+	if opts.Env != nil {
+		cmd.Env, err = execEnv(md, opts.Env)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	stdout := &limitedBuffer{limit: opts.MaxOutput}
+	stderr := &limitedBuffer{limit: opts.MaxOutput}
+	cmd.Stdout = stdout
+	if opts.Output == botconfig_parser.EXEC_OUTPUT_JSON {
+		cmd.Stderr = stderr
+	} else {
+		// для текстового вывода пользователь получает stdout и stderr как при CombinedOutput
+		cmd.Stderr = stdout
+	}
+
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("%w %s", errExecTimeout, cmdParts[0])
+	}
+	if stderr.Len() != 0 {
+		logger.Warning("stderr команды:", cmdParts[0], stderr.String())
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
+
+// текст ошибки exec_button для пользователя: команда завершилась с ненулевым кодом,
+// превысила timeout или не запустилась
+func execErrorMessage(md *MultiData, err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, errExecTimeout):
+		return md.menu.ErrorMessages.ExecButton.Timeout
+	case errors.As(err, &exitErr):
+		return md.menu.ErrorMessages.ExecButton.CommandFailed
+	}
+	return md.menu.ErrorMessages.ButtonProcessing
+}
+
+// окружение команды: NAME берется из окружения бота, в NAME=value можно использовать шаблоны
+func execEnv(md *MultiData, allowlist []string) ([]string, error) {
+	env := make([]string, 0, len(allowlist))
+	for _, v := range allowlist {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok {
+			if value, exist := os.LookupEnv(name); exist {
+				env = append(env, name+"="+value)
+			}
+			continue
+		}
+
+		value, err := fillTemplateWithInfo(md.chatState, value)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, nil
+}
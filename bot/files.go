@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"context"
+	"slices"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/connect/messages"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/logger"
+	"connect-text-bot/internal/us"
+
+	"github.com/google/uuid"
+)
+
+// файл из сообщения пользователя, ok=false если 1С-Коннект не передал id или имя файла
+func messageFile(msg messages.Message) (file database.File, ok bool) {
+	file = database.File{ID: msg.Data.FileID, Name: msg.Data.FileName, Size: msg.Data.FileSize}
+	return file, file.ID != uuid.Nil && file.Name != ""
+}
+
+// файл из сообщения пользователя, если он подходит под правила
+func allowedMessageFile(msg messages.Message, rules *botconfig_parser.FileRules) (database.File, bool) {
+	file, ok := messageFile(msg)
+	return file, ok && rules.Allowed(file.Name, file.Size)
+}
+
+// скачать файл пользователя из 1С-Коннект и прикрепить к заявке
+func attachFile(ctx context.Context, md *MultiData, ticketID uuid.UUID, file database.File) error {
+	content, err := md.bot.connect.GetFile(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+
+	return us.AttachTicketFile(ctx, md.soapclmtom, ticketID, md.msg.UserID, file.Name, content)
+}
+
+// прикрепить к зарегистрированной заявке файлы, полученные при заполнении и из attach_vars
+// заявка уже создана, поэтому ошибки только сообщаются пользователю
+func attachTicketFiles(ctx context.Context, md *MultiData, tBtn *botconfig_parser.TicketButton, ticketID uuid.UUID) {
+	files := slices.Clone(md.chatState.Ticket.Files)
+	for _, varName := range tBtn.AttachVars {
+		if f, ok := md.chatState.Files[varName]; ok {
+			files = append(files, f)
+		}
+	}
+
+	for _, f := range files {
+		if err := attachFile(ctx, md, ticketID, f); err != nil {
+			logger.Warning("Не удалось прикрепить файл к заявке", ticketID, f.Name, err)
+			_ = md.bot.connect.Send(ctx, md.msg.UserID, md.menu.ErrorMessages.TicketButton.FailedAttachFile+": "+f.Name, nil)
+		}
+	}
+
+	// файлы из attach_vars относятся к этой заявке и не должны попасть в следующую
+	err := md.chatState.DeleteCacheFile(md.cacheDB, md.msg.UserID, md.msg.LineID, tBtn.AttachVars...)
+	if err != nil {
+		logger.Warning("Не удалось удалить прикрепленные файлы из переменных", ticketID, err)
+	}
+}
@@ -1,34 +1,53 @@
 package bot
 
 import (
+	"context"
+
+	"connect-text-bot/internal/botconfig_parser"
 	"connect-text-bot/internal/config"
 	"connect-text-bot/internal/connect/client"
 	"connect-text-bot/internal/logger"
+	"connect-text-bot/internal/metrics"
 
 	"github.com/gin-gonic/gin"
 )
 
-const eventUri = "/connect-push/receive/"
+const (
+	eventUri   = "/connect-push/receive/"
+	metricsUri = "/metrics"
+)
 
-func InitHooks(app *gin.Engine, cnf *config.Conf) {
+// menus - загруженные конфиги ботов, ключ - путь к файлу конфига
+func InitHooks(app *gin.Engine, cnf *config.Conf, menus map[string]*botconfig_parser.Levels) {
 	logger.Info("Init receiving endpoint...")
 
-	app.POST(eventUri, Receive)
+	eventDispatcher = newDispatcher(cnf.Dispatcher)
+	guard, err := hookGuard(cnf.Server)
+	if err != nil {
+		logger.Crit("Error while setup hook:", err)
+	}
+	app.POST(eventUri, guard, Receive)
+	app.GET(metricsUri, gin.WrapH(metrics.Handler()))
+	if err := initAdmin(app, cnf.Admin); err != nil {
+		logger.Crit("Error while setup admin API:", err)
+	}
 
 	logger.Info("Setup hooks on 1C-Connect...")
 
-	var err error
-	for _, lineID := range cnf.Line {
-		logger.Info("- hook for line", lineID)
+	for _, line := range cnf.Line {
+		lineID := line.ID
+		logger.Info("- hook for line", lineID, "with bot config", cnf.LineBotConfig(line))
 		connect := client.New(lineID, cnf.ConnectServer.Addr, cnf.Connect.Login, cnf.Connect.Password, cnf.GeneralSettings, cnf.SpecID)
+		connect.SetRetry(cnf.ConnectServer.Retry, cnf.ConnectServer.CircuitBreaker)
 
-		_, err = connect.SetHook(cnf.Server.Host + eventUri)
+		_, err = connect.SetHook(hookUrl(cnf.Server))
 		if err != nil {
 			logger.Crit("Error while setup hook:", err)
 		}
 
 		botsConnect[lineID] = Bot{
 			connect: connect,
+			menu:    menus[cnf.LineBotConfig(line)],
 		}
 	}
 }
@@ -46,3 +65,11 @@ func DestroyHooks() {
 		delete(botsConnect, line_id)
 	}
 }
+
+// StopEvents - перестать принимать события и дождаться обработки принятых
+func StopEvents(ctx context.Context) error {
+	if eventDispatcher == nil {
+		return nil
+	}
+	return eventDispatcher.Close(ctx)
+}
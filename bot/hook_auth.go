@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// параметр адреса hook с секретом
+	hookTokenParam = "token"
+	// ключ контекста, в котором хранится секрет из адреса
+	hookTokenKey = "hook_token"
+)
+
+// HookToken - убрать секрет из адреса запроса событий до логирования, проверяется он в hookGuard
+func HookToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path != eventUri {
+			return
+		}
+
+		query := c.Request.URL.Query()
+		c.Set(hookTokenKey, query.Get(hookTokenParam))
+		query.Del(hookTokenParam)
+		c.Request.URL.RawQuery = query.Encode()
+	}
+}
+
+// адрес для получения событий, который передается в 1С-Коннект
+func hookUrl(server config.Server) string {
+	if server.HookSecret == "" {
+		return server.Host + eventUri
+	}
+	return server.Host + eventUri + "?" + url.Values{hookTokenParam: {server.HookSecret}}.Encode()
+}
+
+// проверить секрет и адрес отправителя события
+func hookGuard(server config.Server) (gin.HandlerFunc, error) {
+	allowed, err := parseAllowedIPs(server.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		if len(allowed) != 0 && !ipAllowed(allowed, net.ParseIP(c.ClientIP())) {
+			logger.Warning("Событие с недопустимого адреса", c.ClientIP())
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		if server.HookSecret != "" {
+			token := c.GetString(hookTokenKey)
+			if subtle.ConstantTimeCompare([]byte(token), []byte(server.HookSecret)) != 1 {
+				logger.Warning("Событие с неверным секретом от", c.ClientIP())
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+	}, nil
+}
+
+// адреса и подсети вида 10.0.0.1 или 10.0.0.0/8
+func parseAllowedIPs(values []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("некорректный адрес в allowed_ips (%s)", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная подсеть в allowed_ips (%s)", v)
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+func ipAllowed(allowed []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/cache"
+)
+
+const (
+	// время ожидания ответа по умолчанию
+	httpButtonTimeout = 10 * time.Second
+	// максимальный размер ответа
+	httpButtonMaxResponse = 1 << 20
+)
+
+var httpButtonClient = &http.Client{}
+
+// выполнить запрос http_button и сохранить поля ответа в переменные
+func httpButtonRequest(ctx context.Context, md *MultiData, hBtn *botconfig_parser.HttpButton) error {
+	chatState, msg := md.chatState, md.msg
+
+	content, target, err := httpRequest(ctx, md, hBtn)
+	if err != nil {
+		return err
+	}
+
+	if len(hBtn.SaveToVars) == 0 {
+		return nil
+	}
+
+	data, err := decodeJson(content)
+	if err != nil {
+		return fmt.Errorf("http_button: ответ %s не в формате JSON: %w", target, err)
+	}
+
+	for varName, path := range hBtn.SaveToVars {
+		value, ok := jsonPath(data, path)
+		if !ok {
+			return fmt.Errorf("http_button: в ответе %s нет поля %s", target, path)
+		}
+		err = chatState.ChangeCacheVars(md.cacheDB, msg.UserID, msg.LineID, varName, jsonValueString(value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// выполнить запрос с шаблонами в адресе, заголовках и теле и вернуть ответ,
+// target - метод и адрес запроса для сообщений об ошибках
+func httpRequest(ctx context.Context, md *MultiData, hBtn *botconfig_parser.HttpButton) (content []byte, target string, err error) {
+	chatState := md.chatState
+
+	reqUrl, err := fillUrlTemplate(chatState, hBtn.Url)
+	if err != nil {
+		return
+	}
+
+	var body io.Reader
+	if hBtn.Body != nil {
+		filled, err := fillTemplateValue(chatState, hBtn.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		jsonData, err := json.Marshal(filled)
+		if err != nil {
+			return nil, "", err
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	timeout := httpButtonTimeout
+	if hBtn.Timeout > 0 {
+		timeout = hBtn.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := hBtn.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	target = method + " " + reqUrl
+
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, body)
+	if err != nil {
+		return
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range hBtn.Headers {
+		value, err := fillTextTemplate(chatState, v)
+		if err != nil {
+			return nil, target, err
+		}
+		req.Header.Set(k, value)
+	}
+
+	resp, err := httpButtonClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	content, err = io.ReadAll(io.LimitReader(resp.Body, httpButtonMaxResponse))
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, target, fmt.Errorf("http_button: %s вернул код %d", target, resp.StatusCode)
+	}
+	return
+}
+
+// заполнить шаблон без экранирования HTML, значения уходят во внешний сервис как есть
+func fillTextTemplate(state *cache.Chat, text string) (string, error) {
+	if !strings.Contains(text, "{{") || !strings.Contains(text, "}}") {
+		return text, nil
+	}
+
+	templ, err := template.New("http").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return executeTextTemplate(templ, state)
+}
+
+// заполнить шаблон адреса, значения в пути экранируются как часть пути, после ? - как параметр запроса
+func fillUrlTemplate(state *cache.Chat, text string) (string, error) {
+	if !strings.Contains(text, "{{") || !strings.Contains(text, "}}") {
+		return text, nil
+	}
+
+	templ, err := template.New("url").Funcs(template.FuncMap{
+		"pathescape":  func(v any) string { return url.PathEscape(fmt.Sprint(v)) },
+		"queryescape": func(v any) string { return url.QueryEscape(fmt.Sprint(v)) },
+	}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	inQuery := false
+	escapeUrlActions(templ.Tree, templ.Tree.Root, &inQuery)
+	return executeTextTemplate(templ, state)
+}
+
+// добавить экранирование в конец каждого вывода значения в шаблоне адреса
+func escapeUrlActions(tree *parse.Tree, list *parse.ListNode, inQuery *bool) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if bytes.ContainsRune(n.Text, '?') {
+				*inQuery = true
+			}
+		case *parse.ActionNode:
+			// присваивание переменной ничего не выводит
+			if len(n.Pipe.Decl) != 0 {
+				continue
+			}
+			name := "pathescape"
+			if *inQuery {
+				name = "queryescape"
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(name).SetTree(tree).SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			escapeUrlActions(tree, n.List, inQuery)
+			escapeUrlActions(tree, n.ElseList, inQuery)
+		case *parse.RangeNode:
+			escapeUrlActions(tree, n.List, inQuery)
+			escapeUrlActions(tree, n.ElseList, inQuery)
+		case *parse.WithNode:
+			escapeUrlActions(tree, n.List, inQuery)
+			escapeUrlActions(tree, n.ElseList, inQuery)
+		}
+	}
+}
+
+func executeTextTemplate(templ *template.Template, state *cache.Chat) (string, error) {
+	var out bytes.Buffer
+	if err := templ.Execute(&out, templateData(state)); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// разобрать JSON, числа остаются в исходном виде
+func decodeJson(content []byte) (data any, err error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	err = dec.Decode(&data)
+	return
+}
+
+// заполнить шаблоны во всех строковых значениях
+func fillTemplateValue(state *cache.Chat, value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return fillTextTemplate(state, v)
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			filled, err := fillTemplateValue(state, item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = filled
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			filled, err := fillTemplateValue(state, item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = filled
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// получить значение по пути вида data.items[0].name, допускается префикс $.
+func jsonPath(data any, path string) (any, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return data, true
+	}
+
+	for _, part := range strings.Split(strings.ReplaceAll(path, "[", ".["), ".") {
+		if part == "" {
+			continue
+		}
+
+		if strings.HasPrefix(part, "[") && strings.HasSuffix(part, "]") {
+			index, err := strconv.Atoi(part[1 : len(part)-1])
+			list, ok := data.([]any)
+			if err != nil || !ok || index < 0 || index >= len(list) {
+				return nil, false
+			}
+			data = list[index]
+			continue
+		}
+
+		obj, ok := data.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if data, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// значение из JSON ответа в виде строки для переменной
+func jsonValueString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/connect/requests"
+	"connect-text-bot/internal/connect/response"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/us"
+)
+
+// длина темы заявки в кнопке списка
+const myTicketsSummaryLen = 40
+
+// статусы закрытых заявок, такие заявки не показываются
+var closedTicketStatuses = []string{"FINISHED", "CANCELLED"}
+
+// показать пользователю список открытых заявок
+func myTickets(ctx context.Context, md *MultiData, btn *botconfig_parser.Button) (string, error) {
+	chatState, msg, bot := md.chatState, md.msg, md.bot
+
+	tickets, err := openTickets(ctx, md)
+	if err != nil {
+		return finalSend(ctx, md, "", err)
+	}
+
+	if len(tickets) == 0 {
+		_ = bot.connect.Send(ctx, msg.UserID, btn.MyTicketsButton.EmptyText, nil)
+		return SendAnswer(ctx, md, md.buttonGoto(btn), nil)
+	}
+
+	// кнопка понадобится при выборе заявки
+	err = chatState.ChangeCacheSavedButton(md.cacheDB, msg.UserID, msg.LineID, btn)
+	if err != nil {
+		return finalSend(ctx, md, "", err)
+	}
+
+	err = bot.connect.Send(ctx, msg.UserID, btn.MyTicketsButton.Text, myTicketsKeyboard(md, tickets))
+	return database.MY_TICKETS, err
+}
+
+// пользователь выбрал заявку из списка или вернулся назад
+func myTicketsSelect(ctx context.Context, md *MultiData, text string) (string, error) {
+	chatState, msg, bot, menu := md.chatState, md.msg, md.bot, md.menu
+
+	// переходим если нажата Назад
+	btn := GetClickedButton(menu, database.MY_TICKETS, text, md.buttonVisible)
+	if goTo := getGoToIfClickedBackBtn(btn, md, true); goTo != "" {
+		err := chatState.ClearCacheOmitemptyFields(md.cacheDB, msg.UserID, msg.LineID)
+		return SendAnswer(ctx, md, goTo, err)
+	}
+
+	savedBtn := chatState.GetCacheSavedButton()
+	if savedBtn == nil || savedBtn.MyTicketsButton == nil {
+		return finalSend(ctx, md, "", fmt.Errorf("не найдена кнопка my_tickets_button для выбора заявки"))
+	}
+
+	// список перечитываем, за время выбора заявки могли закрыть
+	tickets, err := openTickets(ctx, md)
+	if err != nil {
+		return finalSend(ctx, md, "", err)
+	}
+	keyboard := myTicketsKeyboard(md, tickets)
+
+	i := findTicket(tickets, text)
+	if i == -1 {
+		err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.MyTicketsButton.TicketNotFound, keyboard)
+		return database.MY_TICKETS, err
+	}
+
+	info, err := myTicketInfo(md, savedBtn.MyTicketsButton, tickets[i])
+	if err != nil {
+		return finalSend(ctx, md, "", err)
+	}
+
+	err = bot.connect.Send(ctx, msg.UserID, info, keyboard)
+	return database.MY_TICKETS, err
+}
+
+// открытые заявки пользователя на линии: список из us_server, данные заявок из API 1С-Коннект
+func openTickets(ctx context.Context, md *MultiData) ([]response.Ticket, error) {
+	ids, err := us.ReadTicketIDs(ctx, md.soapcl, md.msg.UserID, md.msg.LineID)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := make([]response.Ticket, 0, len(ids))
+	for _, id := range ids {
+		ticket, err := md.bot.connect.GetTicket(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(closedTicketStatuses, ticket.Status.Type) {
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, nil
+}
+
+// найти заявку по тексту кнопки или номеру, text в нижнем регистре
+func findTicket(tickets []response.Ticket, text string) int {
+	return slices.IndexFunc(tickets, func(t response.Ticket) bool {
+		return text == strings.ToLower(myTicketLabel(t)) || text == strings.ToLower(t.Number) || text == "№"+strings.ToLower(t.Number)
+	})
+}
+
+// клавиатура со списком заявок и кнопкой Назад
+func myTicketsKeyboard(md *MultiData, tickets []response.Ticket) *[][]requests.KeyboardKey {
+	keyboard := &[][]requests.KeyboardKey{}
+	for _, t := range tickets {
+		*keyboard = append(*keyboard, []requests.KeyboardKey{{Text: myTicketLabel(t)}})
+	}
+	if k := md.menu.GenKeyboard(database.MY_TICKETS, md.buttonVisible); k != nil {
+		*keyboard = append(*keyboard, *k...)
+	}
+	return keyboard
+}
+
+// текст кнопки заявки: номер, тема и статус
+func myTicketLabel(t response.Ticket) string {
+	summary := []rune(t.Summary)
+	if len(summary) > myTicketsSummaryLen {
+		summary = append(summary[:myTicketsSummaryLen-1], '…')
+	}
+
+	label := "№" + t.Number
+	if len(summary) != 0 {
+		label += " " + string(summary)
+	}
+	if t.Status.Name != "" {
+		label += " (" + t.Status.Name + ")"
+	}
+	return label
+}
+
+// данные заявки по шаблону ticket_info или в стандартном виде
+func myTicketInfo(md *MultiData, btn *botconfig_parser.MyTicketsButton, ticket response.Ticket) (string, error) {
+	if btn.TicketInfo != "" {
+		return fillTicketTemplate(md, btn.TicketInfo, ticket)
+	}
+
+	lines := []string{fmt.Sprintf("Заявка №%s от %s", ticket.Number, ticket.CreatedAt.Local().Format("02.01.2006"))}
+	addLine := func(name, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			lines = append(lines, name+": "+value)
+		}
+	}
+
+	addLine("Тема", ticket.Summary)
+	addLine("Статус", ticket.Status.Name)
+	if ticket.Executor != nil {
+		addLine("Исполнитель", fmt.Sprintf("%s %s %s", ticket.Executor.Surname, ticket.Executor.Name, ticket.Executor.Patronymic))
+	}
+	deadline := ticket.Deadline
+	if t, err := time.Parse(time.RFC3339, deadline); err == nil {
+		deadline = t.Local().Format(database.TICKET_DEADLINE_LAYOUT)
+	}
+	addLine("Срок", deadline)
+	addLine("Решение", ticket.Result)
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// заполнить шаблон данными пользователя и заявки 1С-Коннект,
+// в .Ticket вместо черновика заявки выбранная заявка
+func fillTicketTemplate(md *MultiData, text string, ticket response.Ticket) (string, error) {
+	templ, err := template.New("ticket").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	err = templ.Execute(&out, struct {
+		templateFields
+		Ticket response.Ticket
+	}{
+		templateFields: templateData(md.chatState),
+		Ticket:         ticket,
+	})
+	return out.String(), err
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/cache"
+	"connect-text-bot/internal/database"
+)
+
+// получить варианты save_to_var из options_source
+func loadOptions(ctx context.Context, md *MultiData, source *botconfig_parser.OptionsSource) ([]database.Option, error) {
+	switch {
+	case source.Exec != "":
+		opts := botconfig_parser.ExecOptions{}
+		if source.ExecOptions != nil {
+			opts = *source.ExecOptions
+		}
+		// stderr не должен попасть в список
+		opts.Output = botconfig_parser.EXEC_OUTPUT_JSON
+
+		output, err := runCommand(ctx, md, source.Exec, opts)
+		if err != nil {
+			return nil, err
+		}
+		data, err := decodeJson([]byte(output))
+		if err != nil {
+			return nil, fmt.Errorf("options_source: вывод команды не в формате JSON: %w", err)
+		}
+		return jsonOptions(data, source)
+
+	case source.Http != nil:
+		content, target, err := httpRequest(ctx, md, source.Http)
+		if err != nil {
+			return nil, err
+		}
+		data, err := decodeJson(content)
+		if err != nil {
+			return nil, fmt.Errorf("options_source: ответ %s не в формате JSON: %w", target, err)
+		}
+		return jsonOptions(data, source)
+
+	case source.Connect == botconfig_parser.OPTIONS_CONNECT_SPECIALISTS:
+		specs, err := md.bot.connect.GetSpecialists(ctx, md.msg.LineID)
+		if err != nil {
+			return nil, err
+		}
+		options := make([]database.Option, 0, len(specs))
+		for _, v := range specs {
+			text := strings.TrimSpace(fmt.Sprintf("%s %s %s", v.Surname, v.Name, v.Patronymic))
+			options = append(options, database.Option{Text: text, Value: v.UserID.String()})
+		}
+		return options, nil
+
+	case source.Connect == botconfig_parser.OPTIONS_CONNECT_TICKET_KINDS:
+		kinds, err := md.bot.connect.GetTicketDataKinds(ctx, nil, md.chatState.User.CounterpartOwnerID)
+		if err != nil {
+			return nil, err
+		}
+		options := make([]database.Option, 0, len(kinds))
+		for _, v := range kinds {
+			options = append(options, database.Option{Text: v.Name, Value: v.ID.String()})
+		}
+		return options, nil
+	}
+
+	return nil, fmt.Errorf("options_source: не указан источник вариантов")
+}
+
+// варианты из списка по пути items, элемент списка - строка, число или объект с полями text и value
+func jsonOptions(data any, source *botconfig_parser.OptionsSource) ([]database.Option, error) {
+	value, ok := jsonPath(data, source.Items)
+	items, isList := value.([]any)
+	if !ok || !isList {
+		return nil, fmt.Errorf("options_source: в ответе нет списка %s", source.Items)
+	}
+
+	options := make([]database.Option, 0, len(items))
+	for _, item := range items {
+		if _, isObject := item.(map[string]any); !isObject {
+			text := jsonValueString(item)
+			options = append(options, database.Option{Text: text, Value: text})
+			continue
+		}
+
+		text, ok := jsonPath(item, source.Text)
+		if !ok || jsonValueString(text) == "" {
+			return nil, fmt.Errorf("options_source: в элементе списка нет поля %s", source.Text)
+		}
+		option := database.Option{Text: jsonValueString(text)}
+
+		// без значения сохраняется текст варианта
+		option.Value = option.Text
+		if value, ok := jsonPath(item, source.Value); ok {
+			option.Value = jsonValueString(value)
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// варианты на показанной странице и нужна ли кнопка следующей страницы
+func optionsPage(state *cache.Chat, source *botconfig_parser.OptionsSource) ([]database.Option, bool) {
+	start := state.OptionsPage * source.PageSize
+	if start >= len(state.Options) {
+		start = 0
+	}
+	end := min(start+source.PageSize, len(state.Options))
+	return state.Options[start:end], len(state.Options) > source.PageSize
+}
+
+// номер следующей страницы, после последней показывается первая
+func nextOptionsPage(state *cache.Chat, source *botconfig_parser.OptionsSource) int {
+	page := state.OptionsPage + 1
+	if page*source.PageSize >= len(state.Options) {
+		return 0
+	}
+	return page
+}
+
+// найти вариант по тексту кнопки, text в нижнем регистре
+func findOption(options []database.Option, text string) (database.Option, bool) {
+	for _, v := range options {
+		if strings.ToLower(strings.TrimSpace(v.Text)) == text {
+			return v, true
+		}
+	}
+	return database.Option{}, false
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/cache"
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/connect/client"
+	"connect-text-bot/internal/connect/messages"
+	"connect-text-bot/internal/connect/mock"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/logger"
+
+	"github.com/google/uuid"
+	"github.com/hooklift/gowsdl/soap"
+)
+
+const (
+	// адрес имитации 1С-Коннект, запросы в сеть не уходят
+	simulatorHost = "http://connect.simulator"
+
+	// команда симулятора: пользователь начал обращение
+	simulatorCmdStart = "/start"
+	// команда симулятора: пользователь отправил файл, "/file имя"
+	simulatorCmdFile = "/file "
+	// команда симулятора: завершить работу
+	simulatorCmdExit = "/exit"
+)
+
+// Simulator - прогон сценария бота без подключения к 1С-Коннект
+type Simulator struct {
+	md     MultiData
+	server *mock.Server
+}
+
+func NewSimulator(cnf *config.Conf, menu *botconfig_parser.Levels, data mock.Data) (*Simulator, error) {
+	storeCnf := database.StateStoreConfig{Type: database.STORE_MEMORY}
+	storeCnf.SetDefault()
+	store, err := database.ConnectInMemoryCache(storeCnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.LineID == uuid.Nil {
+		data.LineID = uuid.New()
+	}
+	if data.User.UserID == uuid.Nil {
+		data.User.UserID = uuid.New()
+	}
+	if data.User.Name == "" {
+		data.User.Name = "Иван"
+	}
+
+	server := mock.New(data)
+
+	connect := client.New(data.LineID, simulatorHost, "", "", cnf.GeneralSettings, cnf.SpecID)
+	connect.SetTransport(server.Transport())
+
+	soapcl := soap.NewClient(simulatorHost+mock.SoapUri, soap.WithHTTPClient(&http.Client{Transport: server.Transport()}))
+	soapclmtom := soap.NewClient(simulatorHost+mock.SoapUri, soap.WithHTTPClient(&http.Client{Transport: server.Transport()}), soap.WithMTOM())
+
+	return &Simulator{
+		md: MultiData{
+			cacheDB:    store,
+			dedup:      database.NewDedup(store, cnf.Dedup),
+			soapcl:     soapcl,
+			soapclmtom: soapclmtom,
+			cnf:        cnf,
+			menu:       menu,
+			bot:        Bot{connect: connect, menu: menu},
+			msg:        messages.Message{LineID: data.LineID, UserID: data.User.UserID},
+			events:     newDispatcher(cnf.Dispatcher),
+		},
+		server: server,
+	}, nil
+}
+
+// Close - прервать фоновые задачи бота, например ожидание зарегистрированной заявки
+func (s *Simulator) Close() {
+	_ = s.md.events.Close(context.Background())
+}
+
+// Run - читать сообщения пользователя построчно и выводить ответы бота
+func (s *Simulator) Run(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == simulatorCmdExit {
+			break
+		}
+
+		fmt.Fprintln(out, ">", line)
+
+		prevState := s.State().CurrentState
+		replies := s.Send(line)
+
+		for _, r := range replies {
+			switch {
+			case r.Action != "":
+				fmt.Fprintln(out, "*", r.Action)
+			case r.File != "":
+				fmt.Fprintf(out, "Бот: [файл %s] %s\n", r.File, r.Text)
+			default:
+				fmt.Fprintln(out, "Бот:", r.Text)
+			}
+			for _, key := range r.Keyboard {
+				fmt.Fprintf(out, "  [%s] %s\n", key.ID, key.Text)
+			}
+		}
+		fmt.Fprintf(out, "Состояние: %s -> %s\n", prevState, s.State().CurrentState)
+	}
+	return scanner.Err()
+}
+
+// Send - отправить боту сообщение пользователя или команду симулятора
+func (s *Simulator) Send(text string) []mock.Message {
+	if text == simulatorCmdStart {
+		return s.Event(messages.MESSAGE_TREATMENT_START_BY_USER, "")
+	}
+	if name, ok := strings.CutPrefix(text, simulatorCmdFile); ok {
+		return s.File(strings.TrimSpace(name))
+	}
+	return s.Event(messages.MESSAGE_TEXT, text)
+}
+
+// File - пользователь отправил файл, содержимое берется из files_dir, если там нет такого файла то имя файла
+func (s *Simulator) File(name string) []mock.Message {
+	content, err := os.ReadFile(filepath.Join(s.md.cnf.FilesDir, name))
+	if err != nil {
+		content = []byte(name)
+	}
+
+	md := s.md
+	md.msg.Data.FileID = s.server.AddFile(content)
+	md.msg.Data.FileName = name
+	md.msg.Data.FileSize = int64(len(content))
+	return s.event(&md, messages.MESSAGE_FILE, name)
+}
+
+// Event - обработать событие так же как при получении из 1С-Коннект и вернуть действия бота
+func (s *Simulator) Event(messageType messages.MessageType, text string) []mock.Message {
+	md := s.md
+	return s.event(&md, messageType, text)
+}
+
+func (s *Simulator) event(md *MultiData, messageType messages.MessageType, text string) []mock.Message {
+	md.msg.MessageID = uuid.New()
+	md.msg.MessageType = messageType
+	md.msg.MessageAuthor = &md.msg.UserID
+	md.msg.MessageTime = time.Now().Format(time.RFC3339)
+	md.msg.Text = text
+
+	// событие проходит через ту же очередь пользователя, что и фоновые задачи бота,
+	// ответы забираем после окончания обработки
+	err := md.events.dispatchWait(context.Background(), md.msg.UserID, md.msg.LineID, func() error {
+		processEvent(md)
+		return nil
+	})
+	if err != nil {
+		logger.Warning("Событие не принято", md.msg.LineID, md.msg.UserID, err)
+	}
+
+	return s.server.TakeMessages()
+}
+
+// State - текущее состояние пользователя
+func (s *Simulator) State() cache.Chat {
+	return cache.GetState(s.md.bot.connect, context.Background(), s.md.cacheDB, s.md.msg.UserID, s.md.msg.LineID)
+}
@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/connect/messages"
+	"connect-text-bot/internal/connect/requests"
+	"connect-text-bot/internal/connect/response"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/logger"
+	"connect-text-bot/internal/us"
+)
+
+// предложить пользователю выбрать заявку для сообщений
+func ticketComment(ctx context.Context, md *MultiData, btn *botconfig_parser.Button) (string, error) {
+	chatState, msg, bot := md.chatState, md.msg, md.bot
+
+	tickets, err := openTickets(ctx, md)
+	if err != nil {
+		return finalSend(ctx, md, "", err)
+	}
+
+	if len(tickets) == 0 {
+		_ = bot.connect.Send(ctx, msg.UserID, btn.TicketCommentButton.EmptyText, nil)
+		return SendAnswer(ctx, md, md.buttonGoto(btn), nil)
+	}
+
+	// кнопка понадобится при выборе заявки и после нажатия Готово
+	err = chatState.ChangeCacheSavedButton(md.cacheDB, msg.UserID, msg.LineID, btn)
+	if err != nil {
+		return finalSend(ctx, md, "", err)
+	}
+
+	err = bot.connect.Send(ctx, msg.UserID, btn.TicketCommentButton.Text, ticketCommentSelectKeyboard(md, tickets))
+	return database.TICKET_COMMENT, err
+}
+
+// пользователь выбирает заявку или отправляет в выбранную заявку сообщение или файл
+func ticketCommentReceive(ctx context.Context, md *MultiData, text string) (string, error) {
+	chatState, msg, bot, menu := md.chatState, md.msg, md.bot, md.menu
+
+	savedBtn := chatState.GetCacheSavedButton()
+	if savedBtn == nil || savedBtn.TicketCommentButton == nil {
+		return finalSend(ctx, md, "", fmt.Errorf("не найдена кнопка ticket_comment_button для выбора заявки"))
+	}
+	cBtn := savedBtn.TicketCommentButton
+
+	// кнопки проверяем только у текстовых сообщений
+	var btn *botconfig_parser.Button
+	if msg.MessageType == messages.MESSAGE_TEXT {
+		btn = GetClickedButton(menu, database.TICKET_COMMENT, text, md.buttonVisible)
+	}
+
+	// переходим если нажата Назад
+	if goTo := getGoToIfClickedBackBtn(btn, md, true); goTo != "" {
+		err := chatState.ClearCacheOmitemptyFields(md.cacheDB, msg.UserID, msg.LineID)
+		return SendAnswer(ctx, md, goTo, err)
+	}
+
+	// заявка еще не выбрана
+	if chatState.CommentTicket == nil {
+		tickets, err := openTickets(ctx, md)
+		if err != nil {
+			return finalSend(ctx, md, "", err)
+		}
+
+		i := findTicket(tickets, text)
+		if i == -1 || msg.MessageType != messages.MESSAGE_TEXT {
+			err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketCommentButton.TicketNotFound, ticketCommentSelectKeyboard(md, tickets))
+			return database.TICKET_COMMENT, err
+		}
+
+		err = chatState.ChangeCacheCommentTicket(md.cacheDB, msg.UserID, msg.LineID, &tickets[i])
+		if err != nil {
+			return finalSend(ctx, md, "", err)
+		}
+
+		sendText, err := fillTicketTemplate(md, cBtn.SendText, tickets[i])
+		if err != nil {
+			return finalSend(ctx, md, "", err)
+		}
+
+		err = bot.connect.Send(ctx, msg.UserID, sendText, ticketCommentKeyboard(md))
+		return database.TICKET_COMMENT, err
+	}
+
+	// нажата Готово
+	if btn != nil && btn.Goto == database.TICKET_COMMENT {
+		_ = bot.connect.Send(ctx, msg.UserID, cBtn.DoneText, nil)
+
+		err := chatState.ClearCacheOmitemptyFields(md.cacheDB, msg.UserID, msg.LineID)
+		return SendAnswer(ctx, md, md.buttonGoto(savedBtn), err)
+	}
+
+	// файл проверяем до скачивания
+	if msg.MessageType == messages.MESSAGE_FILE {
+		if _, ok := allowedMessageFile(msg, cBtn.Files); !ok {
+			err := bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketCommentButton.FileNotAllowed, ticketCommentKeyboard(md))
+			return database.TICKET_COMMENT, err
+		}
+	}
+
+	if err := addTicketComment(ctx, md, chatState.CommentTicket); err != nil {
+		logger.Warning("Не удалось добавить сообщение в заявку", chatState.CommentTicket.ID, err)
+		err = bot.connect.Send(ctx, msg.UserID, menu.ErrorMessages.TicketCommentButton.FailedAddComment, ticketCommentKeyboard(md))
+		return database.TICKET_COMMENT, err
+	}
+
+	err := bot.connect.Send(ctx, msg.UserID, cBtn.AddedText, ticketCommentKeyboard(md))
+	return database.TICKET_COMMENT, err
+}
+
+// текст добавляется сообщением заявки, файл скачивается из 1С-Коннект и прикрепляется к заявке
+func addTicketComment(ctx context.Context, md *MultiData, ticket *response.Ticket) error {
+	msg := md.msg
+
+	if msg.MessageType != messages.MESSAGE_FILE {
+		return us.AddTicketMessage(ctx, md.soapcl, ticket.ID, msg.UserID, msg.Text)
+	}
+
+	file, _ := messageFile(msg)
+	return attachFile(ctx, md, ticket.ID, file)
+}
+
+// список заявок и кнопка Назад
+func ticketCommentSelectKeyboard(md *MultiData, tickets []response.Ticket) *[][]requests.KeyboardKey {
+	keyboard := &[][]requests.KeyboardKey{}
+	for _, t := range tickets {
+		*keyboard = append(*keyboard, []requests.KeyboardKey{{Text: myTicketLabel(t)}})
+	}
+	return appendTicketCommentButtons(md, keyboard, false)
+}
+
+// кнопки Готово и Назад после выбора заявки
+func ticketCommentKeyboard(md *MultiData) *[][]requests.KeyboardKey {
+	return appendTicketCommentButtons(md, &[][]requests.KeyboardKey{}, true)
+}
+
+func appendTicketCommentButtons(md *MultiData, keyboard *[][]requests.KeyboardKey, withDone bool) *[][]requests.KeyboardKey {
+	for _, v := range md.menu.Menu[database.TICKET_COMMENT].Buttons {
+		if !withDone && v.Button.Goto == database.TICKET_COMMENT {
+			continue
+		}
+		*keyboard = append(*keyboard, []requests.KeyboardKey{{ID: v.Button.ButtonID, Text: botconfig_parser.Quotes(v.Button.ButtonText)}})
+	}
+	return keyboard
+}
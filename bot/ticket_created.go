@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/cache"
+	"connect-text-bot/internal/connect/response"
+	"connect-text-bot/internal/logger"
+
+	"github.com/google/uuid"
+)
+
+// сколько ждать загрузки зарегистрированной заявки в 1С-Коннект
+var (
+	createdTicketInterval = 4 * time.Second
+	createdTicketAttempts = 10
+)
+
+// сохранить зарегистрированную заявку для шаблонов и отправить пользователю success_text
+func ticketCreated(ctx context.Context, md *MultiData, tBtn *botconfig_parser.TicketButton, ticket response.Ticket) error {
+	chatState, msg := md.chatState, md.msg
+
+	err := chatState.ChangeCacheCreatedTicket(md.cacheDB, msg.UserID, msg.LineID, &ticket)
+	if err != nil {
+		return err
+	}
+
+	text, err := fillTemplateWithInfo(chatState, tBtn.SuccessText)
+	if err != nil {
+		return err
+	}
+
+	return md.bot.connect.Send(ctx, msg.UserID, text, nil)
+}
+
+// дождаться загрузки заявки в 1С-Коннект, не занимая обработку событий пользователя,
+// ожидание прерывается при остановке бота
+func waitCreatedTicket(ctx context.Context, md MultiData, tBtn *botconfig_parser.TicketButton, ticketID uuid.UUID) {
+	for range createdTicketAttempts {
+		select {
+		case <-time.After(createdTicketInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		ticket, err := md.bot.connect.GetTicket(ctx, ticketID)
+		if err != nil {
+			continue
+		}
+
+		// состояние меняем в очереди событий пользователя, за время ожидания оно могло измениться
+		err = md.events.dispatchWait(ctx, md.msg.UserID, md.msg.LineID, func() error {
+			chatState := cache.GetState(md.bot.connect, ctx, md.cacheDB, md.msg.UserID, md.msg.LineID)
+			md.chatState = &chatState
+			return ticketCreated(ctx, &md, tBtn, ticket)
+		})
+		if err != nil {
+			logger.Warning("Не удалось сообщить о регистрации заявки", ticketID, err)
+		}
+		return
+	}
+
+	logger.Warning("Зарегистрированная заявка не загрузилась в 1С-Коннект", ticketID)
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/connect/mock"
+
+	"github.com/goccy/go-yaml"
+)
+
+type (
+	// Transcript - записанный диалог с ожидаемыми ответами бота
+	Transcript struct {
+		// название сценария
+		Name string `yaml:"name"`
+		// данные, которые вернет имитация 1С-Коннект
+		Mock mock.Data `yaml:"mock"`
+		// шаги диалога
+		Steps []TranscriptStep `yaml:"steps"`
+	}
+
+	TranscriptStep struct {
+		// сообщение пользователя или команда симулятора (/start)
+		Send string `yaml:"send"`
+		// ожидаемые действия бота, если не указаны то не проверяются
+		Expect []TranscriptReply `yaml:"expect"`
+		// ожидаемое меню после обработки сообщения, если не указано то не проверяется
+		State string `yaml:"state"`
+	}
+
+	TranscriptReply struct {
+		// текст сообщения
+		Text string `yaml:"text"`
+		// имя отправленного файла
+		File string `yaml:"file"`
+		// текст кнопок клавиатуры, если не указан то не проверяется
+		Keyboard []string `yaml:"keyboard"`
+		// служебное действие: закрытие обращения, перевод на специалиста и т.п.
+		Action string `yaml:"action"`
+	}
+)
+
+func LoadTranscript(path string) (*Transcript, error) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transcript{}
+	if err := yaml.UnmarshalWithOptions(input, t, yaml.Strict()); err != nil {
+		return nil, err
+	}
+	if len(t.Steps) == 0 {
+		return nil, fmt.Errorf("сценарий не содержит шагов (steps)")
+	}
+	return t, nil
+}
+
+// RunTranscript - прогнать диалог через бота и вернуть список расхождений с ожидаемыми ответами
+func RunTranscript(cnf *config.Conf, menu *botconfig_parser.Levels, t *Transcript) (divergences []string, err error) {
+	sim, err := NewSimulator(cnf, menu, t.Mock)
+	if err != nil {
+		return nil, err
+	}
+	defer sim.Close()
+
+	for i, step := range t.Steps {
+		prefix := fmt.Sprintf("шаг %d (%q)", i+1, step.Send)
+
+		replies := sim.Send(step.Send)
+
+		if step.Expect != nil {
+			divergences = append(divergences, compareReplies(prefix, step.Expect, replies)...)
+		}
+
+		if step.State != "" {
+			if state := sim.State().CurrentState; state != step.State {
+				divergences = append(divergences, fmt.Sprintf("%s: ожидалось меню %q, получено %q", prefix, step.State, state))
+			}
+		}
+	}
+
+	return divergences, nil
+}
+
+func compareReplies(prefix string, expected []TranscriptReply, replies []mock.Message) (divergences []string) {
+	for i := range max(len(expected), len(replies)) {
+		if i >= len(replies) {
+			divergences = append(divergences, fmt.Sprintf("%s: ожидалось действие бота #%d %s, бот ничего не сделал", prefix, i+1, expected[i].View()))
+			continue
+		}
+		if i >= len(expected) {
+			divergences = append(divergences, fmt.Sprintf("%s: лишнее действие бота #%d %s", prefix, i+1, replyView(replies[i])))
+			continue
+		}
+
+		e, r := expected[i], replies[i]
+		keyboard := make([]string, 0, len(r.Keyboard))
+		for _, key := range r.Keyboard {
+			keyboard = append(keyboard, key.Text)
+		}
+
+		if strings.TrimSpace(e.Text) != strings.TrimSpace(r.Text) ||
+			e.File != r.File ||
+			e.Action != r.Action ||
+			(e.Keyboard != nil && !slices.Equal(e.Keyboard, keyboard)) {
+			divergences = append(divergences, fmt.Sprintf("%s: действие бота #%d\n\tожидалось: %s\n\tполучено:  %s", prefix, i+1, e.View(), replyView(r)))
+		}
+	}
+	return
+}
+
+func (r TranscriptReply) View() string {
+	return fmt.Sprintf("{text: %q, file: %q, action: %q, keyboard: %q}", r.Text, r.File, r.Action, r.Keyboard)
+}
+
+func replyView(r mock.Message) string {
+	keyboard := make([]string, 0, len(r.Keyboard))
+	for _, key := range r.Keyboard {
+		keyboard = append(keyboard, key.Text)
+	}
+	return TranscriptReply{Text: r.Text, File: r.File, Keyboard: keyboard, Action: r.Action}.View()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"connect-text-bot/bot"
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/logger"
+
+	"github.com/google/uuid"
+)
+
+// broadcast - рассылка через API администратора запущенного бота
+func broadcast(args []string) int {
+	var (
+		cnf = &config.Conf{}
+
+		fs         = flag.NewFlagSet("broadcast", flag.ExitOnError)
+		configFile = fs.String("config", "./config/config.yml", "Usage: -config=<config_file>, admin.token and server.host are used")
+		addr       = fs.String("addr", "", "Usage: -addr=http://127.0.0.1:9001, bot address, server.host by default")
+		line       = fs.String("line", "", "Usage: -line=<line_id>")
+		users      = fs.String("users", "-", "Usage: -users=<file>, user ids one per line, - for stdin")
+		text       = fs.String("text", "", "Usage: -text=<message>")
+		file       = fs.String("file", "", "Usage: -file=<file_name>, file from files_dir")
+		menu       = fs.String("menu", "", "Usage: -menu=<menu_id>, move users to the menu")
+		dryRun     = fs.Bool("dry-run", false, "Usage: -dry-run, check the request without sending")
+	)
+
+	_ = fs.Parse(args)
+
+	loggerConfig := ""
+	logger.InitLogger(false, &loggerConfig)
+
+	config.GetConfig(*configFile, cnf)
+	if cnf.Admin.Token == "" {
+		logger.Warning("Не задан admin.token в конфиге, API администратора выключено")
+		return 1
+	}
+	if *addr == "" {
+		*addr = cnf.Server.Host
+	}
+
+	req := bot.BroadcastRequest{
+		Text:   *text,
+		File:   *file,
+		Menu:   *menu,
+		DryRun: *dryRun,
+	}
+
+	var err error
+	if req.LineID, err = uuid.Parse(*line); err != nil {
+		logger.Warning("Некорректный id линии", *line)
+		return 1
+	}
+	if req.Users, err = readUserIDs(*users); err != nil {
+		logger.Warning("Не удалось прочитать список получателей", err)
+		return 1
+	}
+
+	report, err := postBroadcast(strings.TrimSuffix(*addr, "/")+bot.BroadcastUri, cnf.Admin.Token, req)
+	if err != nil {
+		logger.Warning("Ошибка рассылки", err)
+		return 1
+	}
+
+	printBroadcastReport(os.Stdout, report)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// id пользователей по одному в строке, пустые строки и комментарии # пропускаются
+func readUserIDs(name string) ([]uuid.UUID, error) {
+	in := os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var ids []uuid.UUID
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный id пользователя (%s)", value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, scanner.Err()
+}
+
+func postBroadcast(url, token string, req bot.BroadcastRequest) (report bot.BroadcastReport, err error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return report, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+
+	err = json.Unmarshal(content, &report)
+	return
+}
+
+func printBroadcastReport(out io.Writer, r bot.BroadcastReport) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "Пользователь\tрезультат\tошибка")
+	for _, res := range r.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", res.UserID, res.Status, res.Error)
+	}
+	fmt.Fprintf(w, "\nОтправлено: %d, ошибок: %d\n", r.Sent, r.Failed)
+}
@@ -2,7 +2,12 @@ package botconfig_parser
 
 import (
 	"fmt"
+	"net/http"
+	"slices"
 	"strings"
+	"time"
+
+	"connect-text-bot/internal/database"
 
 	"github.com/google/uuid"
 )
@@ -19,8 +24,17 @@ type Levels struct {
 	AppointRandomSpecFromListButton *Button `yaml:"appoint_random_spec_from_list_button"`
 	RerouteButton                   *Button `yaml:"reroute_button"`
 	ExecButton                      *Button `yaml:"exec_button"`
+	HttpButton                      *Button `yaml:"http_button"`
 	SaveToVar                       *Button `yaml:"save_to_var"`
 	TicketButton                    *Button `yaml:"ticket_button"`
+	MyTicketsButton                 *Button `yaml:"my_tickets_button"`
+	TicketCommentButton             *Button `yaml:"ticket_comment_button"`
+
+	// действие при переводе на специалиста, если нет свободных специалистов
+	NoSpecialists *Button `yaml:"no_specialists"`
+
+	// расписание рабочего времени
+	Schedule *Schedule `yaml:"schedule"`
 
 	GreetingMessage string `yaml:"greeting_message"`
 	FirstGreeting   bool   `yaml:"first_greeting"`
@@ -38,6 +52,11 @@ type Menu struct {
 	DoButton *Button `yaml:"do_button,omitempty"`
 
 	QnaDisable bool `yaml:"qna_disable"`
+
+	// когда доступно меню: working_hours или off_hours, кнопки ведущие в недоступное меню скрываются
+	AvailableWhen string `yaml:"available_when,omitempty"`
+	// вне рабочего времени вместо меню перейти в указанное
+	OffHoursGoto string `yaml:"off_hours_goto,omitempty"`
 }
 
 type ErrorMessages struct {
@@ -47,6 +66,8 @@ type ErrorMessages struct {
 	ButtonProcessing string `yaml:"button_processing"`
 	// Ошибка: Не удалось отправить файл
 	FailedSendFile string `yaml:"failed_send_file"`
+	// Сервис временно недоступен. Попробуйте повторить запрос позже
+	TemporaryUnavailable string `yaml:"temporary_unavailable"`
 
 	AppointSpecButton struct {
 		// Выбранный специалист недоступен
@@ -63,6 +84,22 @@ type ErrorMessages struct {
 		SelectedLineNotAvailable string `yaml:"selected_line_not_available"`
 	} `yaml:"reroute_button"`
 
+	ExecButton struct {
+		// Команда завершилась с ошибкой
+		CommandFailed string `yaml:"command_failed"`
+		// Превышено время выполнения команды
+		Timeout string `yaml:"timeout"`
+	} `yaml:"exec_button"`
+
+	SaveToVar struct {
+		// Получено некорректное значение. Повторите попытку
+		ReceivedIncorrectValue string `yaml:"received_incorrect_value"`
+		// Превышено количество попыток ввода
+		RetryLimitExceeded string `yaml:"retry_limit_exceeded"`
+		// Файл не подходит. Проверьте тип и размер файла
+		FileNotAllowed string `yaml:"file_not_allowed"`
+	} `yaml:"save_to_var"`
+
 	TicketButton struct {
 		// Данный этап нельзя пропустить
 		StepCannotBeSkipped string `yaml:"step_cannot_be_skipped"`
@@ -70,7 +107,27 @@ type ErrorMessages struct {
 		ReceivedIncorrectValue string `yaml:"received_incorrect_value"`
 		// Ожидалось нажатие на кнопку. Повторите попытку
 		ExpectedButtonPress string `yaml:"expected_button_press"`
+		// Такая заявка уже зарегистрирована
+		AlreadyRegistered string `yaml:"already_registered"`
+		// Файл не подходит. Проверьте тип и размер файла
+		FileNotAllowed string `yaml:"file_not_allowed"`
+		// Не удалось прикрепить файл к заявке
+		FailedAttachFile string `yaml:"failed_attach_file"`
 	} `yaml:"ticket_button"`
+
+	MyTicketsButton struct {
+		// Заявка не найдена. Выберите заявку из списка
+		TicketNotFound string `yaml:"ticket_not_found"`
+	} `yaml:"my_tickets_button"`
+
+	TicketCommentButton struct {
+		// Заявка не найдена. Выберите заявку из списка
+		TicketNotFound string `yaml:"ticket_not_found"`
+		// Не удалось добавить сообщение в заявку. Повторите попытку
+		FailedAddComment string `yaml:"failed_add_comment"`
+		// Файл не подходит. Проверьте тип и размер файла
+		FileNotAllowed string `yaml:"file_not_allowed"`
+	} `yaml:"ticket_comment_button"`
 }
 
 type QNA struct {
@@ -84,6 +141,8 @@ type Answer struct {
 	File string `yaml:"file,omitempty"`
 	// сопроводительный текст к файлу
 	FileText string `yaml:"file_text,omitempty"`
+	// условие отправки сообщения
+	If string `yaml:"if,omitempty"`
 }
 
 type Buttons struct {
@@ -96,6 +155,9 @@ type NestedMenu struct {
 	Buttons []*Buttons `yaml:"buttons"`
 
 	QnaDisable bool `yaml:"qna_disable"`
+
+	AvailableWhen string `yaml:"available_when,omitempty"`
+	OffHoursGoto  string `yaml:"off_hours_goto,omitempty"`
 }
 
 type Button struct {
@@ -103,6 +165,12 @@ type Button struct {
 	ButtonID string `yaml:"id"`
 	// текст кнопки
 	ButtonText string `yaml:"text"`
+	// условие отображения кнопки
+	If string `yaml:"if,omitempty"`
+	// когда доступна кнопка: working_hours или off_hours
+	AvailableWhen string `yaml:"available_when,omitempty"`
+	// вне рабочего времени вместо действия кнопки перейти в меню
+	OffHoursGoto string `yaml:"off_hours_goto,omitempty"`
 	// сообщение
 	Chat []*Answer `yaml:"chat,omitempty"`
 	// закрыть обращение
@@ -119,16 +187,33 @@ type Button struct {
 	RerouteButton *uuid.UUID `yaml:"reroute_button,omitempty"`
 	// Выполнить команду на стороне сервера
 	ExecButton string `yaml:"exec_button,omitempty"`
+	// настройки выполнения команды exec_button
+	ExecOptions *ExecOptions `yaml:"exec_options,omitempty"`
+	// выполнить http запрос к внешнему сервису
+	HttpButton *HttpButton `yaml:"http_button,omitempty"`
 	// получить и сохранить текст введенный пользователем
 	SaveToVar *SaveToVar `yaml:"save_to_var,omitempty"`
 	// зарегистрировать заявку
 	TicketButton *TicketButton `yaml:"ticket_button,omitempty"`
+	// показать открытые заявки пользователя
+	MyTicketsButton *MyTicketsButton `yaml:"my_tickets_button,omitempty"`
+	// добавить сообщения и файлы в открытую заявку
+	TicketCommentButton *TicketCommentButton `yaml:"ticket_comment_button,omitempty"`
 	// перейти в меню
 	Goto string `yaml:"goto"`
+	// перейти в меню первого выполненного условия, иначе в goto
+	GotoSwitch []*GotoCase `yaml:"goto_switch,omitempty"`
 	// вложенное меню
 	NestedMenu *NestedMenu `yaml:"menu"`
 }
 
+type GotoCase struct {
+	// условие перехода, если не указано то выполняется всегда
+	If string `yaml:"if,omitempty"`
+	// перейти в меню
+	Goto string `yaml:"goto"`
+}
+
 // добавить таб в начале каждой строки
 func tabLines(input, tabs string) string {
 	lines := strings.Split(input, "\n")
@@ -149,6 +234,12 @@ func (b Menu) View() (btnStr string) {
 	}
 
 	btnStr += fmt.Sprintf("\nQnaDisable: %v", b.QnaDisable)
+	if b.AvailableWhen != "" {
+		btnStr += fmt.Sprintf("\nAvailableWhen: %s", b.AvailableWhen)
+	}
+	if b.OffHoursGoto != "" {
+		btnStr += fmt.Sprintf("\nOffHoursGoto: %s", b.OffHoursGoto)
+	}
 
 	return fmt.Sprintf("%s\n", tabLines(btnStr, "\t"))
 }
@@ -156,6 +247,15 @@ func (b Menu) View() (btnStr string) {
 func (b Button) View() (btnStr string) {
 	btnStr += fmt.Sprintf("\nButtonID: %s", b.ButtonID)
 	btnStr += fmt.Sprintf("\nButtonText: %s", b.ButtonText)
+	if b.If != "" {
+		btnStr += fmt.Sprintf("\nIf: %s", b.If)
+	}
+	if b.AvailableWhen != "" {
+		btnStr += fmt.Sprintf("\nAvailableWhen: %s", b.AvailableWhen)
+	}
+	if b.OffHoursGoto != "" {
+		btnStr += fmt.Sprintf("\nOffHoursGoto: %s", b.OffHoursGoto)
+	}
 	btnStr += fmt.Sprintf("\nlen(Chat): %d", len(b.Chat))
 
 	btnCnf := make([]string, 0)
@@ -180,16 +280,28 @@ func (b Button) View() (btnStr string) {
 	if b.ExecButton != "" {
 		btnCnf = append(btnCnf, "ExecButton")
 	}
+	if b.HttpButton != nil {
+		btnCnf = append(btnCnf, "HttpButton")
+	}
 	if b.SaveToVar != nil {
 		btnCnf = append(btnCnf, "SaveToVar")
 	}
 	if b.TicketButton != nil {
 		btnCnf = append(btnCnf, "TicketButton")
 	}
+	if b.MyTicketsButton != nil {
+		btnCnf = append(btnCnf, "MyTicketsButton")
+	}
+	if b.TicketCommentButton != nil {
+		btnCnf = append(btnCnf, "TicketCommentButton")
+	}
 
 	btnStr += fmt.Sprintf("\nModifier: %v", btnCnf)
 
 	btnStr += fmt.Sprintf("\nGoto: %s", b.Goto)
+	for _, v := range b.GotoSwitch {
+		btnStr += fmt.Sprintf("\nGotoSwitch: { If: %s, Goto: %s }", v.If, v.Goto)
+	}
 	if b.NestedMenu != nil {
 		btnStr += fmt.Sprintf("\nNestedMenu ID: %v", b.NestedMenu.ID)
 	}
@@ -199,8 +311,20 @@ func (b Button) View() (btnStr string) {
 
 func (b SaveToVar) View() (btnStr string) {
 	btnStr += fmt.Sprintf("\nVarName: %s", b.VarName)
-	btnStr += fmt.Sprintf("\nSendText: %s", *b.SendText)
+	if b.SendText != nil {
+		btnStr += fmt.Sprintf("\nSendText: %s", *b.SendText)
+	}
 	btnStr += fmt.Sprintf("\nlen(OfferOptions): %d", len(b.OfferOptions))
+	if b.OptionsSource != nil {
+		btnStr += fmt.Sprintf("\nOptionsSource: {%s}", b.OptionsSource.View())
+	}
+	btnStr += fmt.Sprintf("\nlen(Validate): %d", len(b.Validate))
+	if b.FailGoto != "" {
+		btnStr += fmt.Sprintf("\nFailGoto: %s", b.FailGoto)
+	}
+	if b.Files != nil {
+		btnStr += fmt.Sprintf("\nFiles: { Extensions: %v, MaxSize: %d }", b.Files.Extensions, b.Files.MaxSize)
+	}
 
 	if b.DoButton != nil {
 		btnStr += fmt.Sprintf("\nDoButton: {%s}", b.DoButton.View())
@@ -232,18 +356,88 @@ func (b TicketButton) View() (btnStr string) {
 	btnStr += tabLines(formatPartTicket("Executor", b.Data.Executor), "\t")
 	btnStr += tabLines(formatPartTicket("Service", b.Data.Service), "\t")
 	btnStr += tabLines(formatPartTicket("ServiceType", b.Data.ServiceType), "\t")
+	if b.Data.Fields != nil {
+		btnStr += tabLines(formatPartTicket("Fields", b.Data.Fields), "\t")
+	}
+	if b.Data.Priority != nil {
+		btnStr += tabLines(formatPartTicket("Priority", b.Data.Priority), "\t")
+	}
+	if b.Data.Deadline != nil {
+		btnStr += tabLines(formatPartTicket("Deadline", b.Data.Deadline), "\t")
+	}
 	btnStr += "\n}"
 
+	if b.Files != nil {
+		btnStr += fmt.Sprintf("\nFiles: { Extensions: %v, MaxSize: %d }", b.Files.Extensions, b.Files.MaxSize)
+	}
+	if len(b.AttachVars) != 0 {
+		btnStr += fmt.Sprintf("\nAttachVars: %v", b.AttachVars)
+	}
 	btnStr += fmt.Sprintf("\nGoto: %s", b.Goto)
 
 	return fmt.Sprintf("%s\n", tabLines(btnStr, "\t"))
 }
 
+func (b MyTicketsButton) View() (btnStr string) {
+	btnStr += fmt.Sprintf("\nText: %s", b.Text)
+	btnStr += fmt.Sprintf("\nEmptyText: %s", b.EmptyText)
+	btnStr += fmt.Sprintf("\nlen(TicketInfo): %d", len([]rune(b.TicketInfo)))
+
+	return fmt.Sprintf("%s\n", tabLines(btnStr, "\t"))
+}
+
+// MyTicketsButton - список открытых заявок пользователя, по выбору заявки выводится ее состояние
+type MyTicketsButton struct {
+	// текст перед списком заявок
+	Text string `yaml:"text,omitempty"`
+	// текст если открытых заявок нет
+	EmptyText string `yaml:"empty_text,omitempty"`
+	// шаблон текста с данными выбранной заявки, заявка доступна как {{.Ticket}}
+	TicketInfo string `yaml:"ticket_info,omitempty"`
+}
+
+func (b TicketCommentButton) View() (btnStr string) {
+	btnStr += fmt.Sprintf("\nText: %s", b.Text)
+	btnStr += fmt.Sprintf("\nEmptyText: %s", b.EmptyText)
+	btnStr += fmt.Sprintf("\nSendText: %s", b.SendText)
+	btnStr += fmt.Sprintf("\nAddedText: %s", b.AddedText)
+	btnStr += fmt.Sprintf("\nDoneText: %s", b.DoneText)
+	if b.Files != nil {
+		btnStr += fmt.Sprintf("\nFiles: { Extensions: %v, MaxSize: %d }", b.Files.Extensions, b.Files.MaxSize)
+	}
+
+	return fmt.Sprintf("%s\n", tabLines(btnStr, "\t"))
+}
+
+// TicketCommentButton - пользователь выбирает открытую заявку и отправляет в нее сообщения и файлы
+type TicketCommentButton struct {
+	// текст перед списком заявок
+	Text string `yaml:"text,omitempty"`
+	// текст если открытых заявок нет
+	EmptyText string `yaml:"empty_text,omitempty"`
+	// текст после выбора заявки, заявка доступна как {{.Ticket}}
+	SendText string `yaml:"send_text,omitempty"`
+	// ответ на каждое добавленное сообщение или файл
+	AddedText string `yaml:"added_text,omitempty"`
+	// текст после нажатия Готово
+	DoneText string `yaml:"done_text,omitempty"`
+	// какие файлы принимать, если не указано то любые
+	Files *FileRules `yaml:"files,omitempty"`
+}
+
 type TicketButton struct {
 	// Канал связи
 	ChannelID uuid.UUID `yaml:"channel_id"`
 	// шаблон текста, где выводятся заполненные данные заявки
 	TicketInfo string `yaml:"ticket_info"`
+	// сообщение после регистрации заявки, в шаблоне доступна заявка {{ .CreatedTicket }}
+	SuccessText string `yaml:"success_text,omitempty"`
+	// какие файлы принимать на шагах темы и описания, файлы прикрепляются к заявке
+	Files *FileRules `yaml:"files,omitempty"`
+	// ответ на полученный файл
+	FileAddedText string `yaml:"file_added_text,omitempty"`
+	// прикрепить к заявке файлы, сохраненные save_to_var в эти переменные
+	AttachVars []string `yaml:"attach_vars,omitempty"`
 	// данные заполняемой заявки
 	Data *struct {
 		// тема заявки
@@ -256,12 +450,120 @@ type TicketButton struct {
 		Service *PartTicket `yaml:"service"`
 		// тип услуги
 		ServiceType *PartTicket `yaml:"type"`
+		// дополнительные поля выбранного типа услуги, необязательный шаг
+		Fields *PartTicket `yaml:"fields,omitempty"`
+		// приоритет: LOW, STANDARD, HIGH, необязательный шаг
+		Priority *PartTicket `yaml:"priority,omitempty"`
+		// срок: 02.01.2006, 02.01.2006 15:04 или через сколько от текущего времени 72h, необязательный шаг
+		Deadline *PartTicket `yaml:"deadline,omitempty"`
 	} `yaml:"data"`
 
 	// перейти в меню при окончание или отмене
 	Goto string `yaml:"goto"`
 }
 
+// формат вывода exec_button
+const (
+	EXEC_OUTPUT_TEXT = "text"
+	EXEC_OUTPUT_JSON = "json"
+)
+
+type ExecOptions struct {
+	// максимальное время выполнения команды
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// рабочая папка команды
+	WorkDir string `yaml:"work_dir,omitempty"`
+	// переменные окружения доступные команде: NAME - взять из окружения бота, NAME=value - задать значение
+	// если не указаны, команде доступно все окружение бота
+	Env []string `yaml:"env,omitempty"`
+	// максимальный размер вывода в байтах, остальное отбрасывается
+	MaxOutput int `yaml:"max_output,omitempty"`
+	// формат вывода команды: text - отправить пользователю, json - {"text": "...", "vars": {...}}
+	Output string `yaml:"output,omitempty"`
+	// перейти в меню если команда завершилась с ошибкой
+	FailGoto string `yaml:"fail_goto,omitempty"`
+}
+
+func (b ExecOptions) View() (btnStr string) {
+	btnStr += fmt.Sprintf("\nTimeout: %s", b.Timeout)
+	btnStr += fmt.Sprintf("\nWorkDir: %s", b.WorkDir)
+	btnStr += fmt.Sprintf("\nEnv: %v", b.Env)
+	btnStr += fmt.Sprintf("\nMaxOutput: %d", b.MaxOutput)
+	btnStr += fmt.Sprintf("\nOutput: %s", b.Output)
+	btnStr += fmt.Sprintf("\nFailGoto: %s", b.FailGoto)
+
+	return fmt.Sprintf("%s\n", tabLines(btnStr, "\t"))
+}
+
+// проверить настройки выполнения команды
+func (o *ExecOptions) check() error {
+	if o.Timeout < 0 || o.MaxOutput < 0 {
+		return fmt.Errorf("некорректные timeout или max_output")
+	}
+	if !slices.Contains([]string{"", EXEC_OUTPUT_TEXT, EXEC_OUTPUT_JSON}, o.Output) {
+		return fmt.Errorf("неизвестный формат вывода (%s)", o.Output)
+	}
+	for _, v := range o.Env {
+		if name, _, _ := strings.Cut(v, "="); name == "" {
+			return fmt.Errorf("некорректная переменная окружения (%s)", v)
+		}
+	}
+	return nil
+}
+
+type HttpButton struct {
+	// адрес запроса
+	Url string `yaml:"url"`
+	// метод запроса, по умолчанию GET
+	Method string `yaml:"method,omitempty"`
+	// заголовки запроса
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// тело запроса, отправляется в формате JSON
+	Body any `yaml:"body,omitempty"`
+	// время ожидания ответа, по умолчанию 10s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// сохранить поля ответа в переменные: имя переменной - путь к полю в ответе (data.items[0].name)
+	SaveToVars map[string]string `yaml:"save_to_vars,omitempty"`
+	// перейти в меню при ошибке запроса
+	FailGoto string `yaml:"fail_goto,omitempty"`
+}
+
+func (b HttpButton) View() (btnStr string) {
+	btnStr += fmt.Sprintf("\nMethod: %s", b.Method)
+	btnStr += fmt.Sprintf("\nUrl: %s", b.Url)
+	btnStr += fmt.Sprintf("\nlen(Headers): %d", len(b.Headers))
+	btnStr += fmt.Sprintf("\nlen(SaveToVars): %d", len(b.SaveToVars))
+	btnStr += fmt.Sprintf("\nFailGoto: %s", b.FailGoto)
+
+	return fmt.Sprintf("%s\n", tabLines(btnStr, "\t"))
+}
+
+// проверить настройки запроса и привести метод к верхнему регистру
+func (b *HttpButton) check() error {
+	if b.Url == "" {
+		return fmt.Errorf("отсутствует адрес запроса (url)")
+	}
+	b.Method = strings.ToUpper(b.Method)
+	if b.Method == "" {
+		b.Method = http.MethodGet
+	}
+	if !slices.Contains([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, b.Method) {
+		return fmt.Errorf("неподдерживаемый метод (%s)", b.Method)
+	}
+	if b.Body != nil && b.Method == http.MethodGet {
+		return fmt.Errorf("у GET запроса не может быть body")
+	}
+	if b.Timeout < 0 {
+		return fmt.Errorf("некорректный timeout")
+	}
+	for varName := range b.SaveToVars {
+		if varName == database.VAR_FOR_SAVE {
+			return fmt.Errorf("используется зарезервированное имя переменной")
+		}
+	}
+	return nil
+}
+
 type PartTicket struct {
 	// не показывать кнопку пропуска
 	Required bool `yaml:"required,omitempty"`
@@ -271,6 +573,21 @@ type PartTicket struct {
 	DefaultValue *string `yaml:"value,omitempty"`
 }
 
+// разобрать срок заявки: 02.01.2006 15:04, 02.01.2006 - до конца дня или 72h - через сколько от now
+func ParseDeadline(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	if t, err := time.ParseInLocation(database.TICKET_DEADLINE_LAYOUT, value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("02.01.2006", value, now.Location()); err == nil {
+		return t.Add(24*time.Hour - time.Minute), nil
+	}
+	return time.Time{}, fmt.Errorf("некорректный срок (%s)", value)
+}
+
 type SaveToVar struct {
 	// имя переменной в которую будет сохранено сообщение пользователя
 	VarName string `yaml:"var_name"`
@@ -279,6 +596,14 @@ type SaveToVar struct {
 
 	// список вариантов из которых пользователь может выбрать ответ
 	OfferOptions []string `yaml:"offer_options,omitempty"`
+	// откуда получить дополнительные варианты, варианты получаются при нажатии на кнопку
+	OptionsSource *OptionsSource `yaml:"options_source,omitempty"`
+	// правила проверки введенного значения
+	Validate []*ValidateRule `yaml:"validate,omitempty"`
+	// перейти в меню при превышении количества попыток ввода
+	FailGoto string `yaml:"fail_goto,omitempty"`
+	// принимать файлы от пользователя, в переменную сохраняется имя файла
+	Files *FileRules `yaml:"files,omitempty"`
 	// после получения сообщения пользователя выполнить действие по кнопке
 	DoButton *Button `yaml:"do_button"`
 }
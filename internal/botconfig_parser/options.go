@@ -0,0 +1,111 @@
+package botconfig_parser
+
+import (
+	"fmt"
+	"slices"
+)
+
+// данные 1С-Коннект для вариантов save_to_var
+const (
+	OPTIONS_CONNECT_SPECIALISTS  = "specialists"
+	OPTIONS_CONNECT_TICKET_KINDS = "ticket_kinds"
+)
+
+const (
+	// вариантов на одной странице по умолчанию
+	optionsPageSize = 10
+	// кнопка следующей страницы по умолчанию
+	optionsMoreText = "Ещё…"
+)
+
+// OptionsSource - откуда получить варианты save_to_var, указывается только один источник
+type OptionsSource struct {
+	// команда, которая печатает список вариантов в формате JSON
+	Exec string `yaml:"exec,omitempty"`
+	// настройки выполнения команды, output и fail_goto не используются
+	ExecOptions *ExecOptions `yaml:"exec_options,omitempty"`
+	// запрос, который возвращает список вариантов в формате JSON, save_to_vars и fail_goto не используются
+	Http *HttpButton `yaml:"http,omitempty"`
+	// данные 1С-Коннект: specialists, ticket_kinds
+	Connect string `yaml:"connect,omitempty"`
+
+	// путь к списку в JSON (data.items), по умолчанию весь ответ
+	Items string `yaml:"items,omitempty"`
+	// путь к тексту кнопки в элементе списка, по умолчанию text
+	Text string `yaml:"text,omitempty"`
+	// путь к сохраняемому значению в элементе списка, по умолчанию value, если нет то сохраняется текст
+	Value string `yaml:"value,omitempty"`
+
+	// сколько вариантов показывать на одной странице
+	PageSize int `yaml:"page_size,omitempty"`
+	// текст кнопки следующей страницы
+	MoreText string `yaml:"more_text,omitempty"`
+}
+
+func (s OptionsSource) View() (btnStr string) {
+	if s.Exec != "" {
+		btnStr += fmt.Sprintf("\nExec: %s", s.Exec)
+	}
+	if s.Http != nil {
+		btnStr += fmt.Sprintf("\nHttp: {%s}", s.Http.View())
+	}
+	if s.Connect != "" {
+		btnStr += fmt.Sprintf("\nConnect: %s", s.Connect)
+	}
+	btnStr += fmt.Sprintf("\nItems: %s", s.Items)
+	btnStr += fmt.Sprintf("\nText: %s", s.Text)
+	btnStr += fmt.Sprintf("\nValue: %s", s.Value)
+	btnStr += fmt.Sprintf("\nPageSize: %d", s.PageSize)
+
+	return fmt.Sprintf("%s\n", tabLines(btnStr, "\t"))
+}
+
+// проверить настройки и заполнить значения по умолчанию
+func (s *OptionsSource) check() error {
+	sources := 0
+	for _, ok := range []bool{s.Exec != "", s.Http != nil, s.Connect != ""} {
+		if ok {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("нужно указать один источник: exec, http или connect")
+	}
+
+	if s.ExecOptions != nil {
+		if s.Exec == "" {
+			return fmt.Errorf("exec_options используется без exec")
+		}
+		if err := s.ExecOptions.check(); err != nil {
+			return err
+		}
+	}
+	if s.Http != nil {
+		if err := s.Http.check(); err != nil {
+			return err
+		}
+	}
+	if s.Connect != "" && !slices.Contains([]string{OPTIONS_CONNECT_SPECIALISTS, OPTIONS_CONNECT_TICKET_KINDS}, s.Connect) {
+		return fmt.Errorf("неизвестные данные connect (%s)", s.Connect)
+	}
+	if s.Connect != "" && (s.Items != "" || s.Text != "" || s.Value != "") {
+		return fmt.Errorf("для connect нельзя указать items, text и value")
+	}
+
+	if s.PageSize < 0 {
+		return fmt.Errorf("некорректный page_size")
+	}
+	if s.PageSize == 0 {
+		s.PageSize = optionsPageSize
+	}
+	if s.MoreText == "" {
+		s.MoreText = optionsMoreText
+	}
+	if s.Connect == "" && s.Text == "" {
+		s.Text = "text"
+	}
+	if s.Connect == "" && s.Value == "" {
+		s.Value = "value"
+	}
+	return nil
+}
@@ -8,51 +8,38 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"connect-text-bot/internal/connect/requests"
 	"connect-text-bot/internal/database"
 	"connect-text-bot/internal/logger"
 
-	"github.com/gin-gonic/gin"
 	"github.com/goccy/go-yaml"
 	"github.com/google/uuid"
 )
 
 var lock = &sync.RWMutex{}
-var levels *Levels
 
+// InitLevels - загрузить конфиг бота, у каждого файла конфига свой набор меню
 func InitLevels(path string) *Levels {
-	if levels == nil {
-		lock.Lock()
-		defer lock.Unlock()
-		if levels == nil {
-			var err error
-			levels, err = loadMenus(path)
-			if err != nil {
-				logger.Crit(err)
-			}
-			err = levels.checkMenus()
-			if err != nil {
-				logger.Crit(err)
-			}
-		} else {
-			logger.Warning("Levels already created")
-		}
-	} else {
-		logger.Warning("Levels already created")
+	levels, err := loadMenus(path)
+	if err != nil {
+		logger.Crit(path, err)
 	}
 	return levels
 }
 
-func (_ *Levels) UpdateLevels(path string) error {
+// UpdateLevels - перечитать конфиг бота из файла
+func (l *Levels) UpdateLevels(path string) error {
 	newLevel, err := loadMenus(path)
 	if err != nil {
 		return err
 	}
-	if err := newLevel.checkMenus(); err != nil {
-		return err
-	}
-	*levels = *newLevel
+
+	lock.Lock()
+	defer lock.Unlock()
+	*l = *newLevel
 	return nil
 }
 
@@ -140,6 +127,31 @@ func defaultCreateTicketMenuBtnCnf() *Menu {
 	}
 }
 
+// настройки только кнопок, список заявок добавляется перед ними
+func defaultMyTicketsMenuBtnCnf() *Menu {
+	return &Menu{
+		Answer: []*Answer{
+			{Chat: "<my_tickets_answer>"},
+		},
+		Buttons: []*Buttons{
+			{Button{ButtonID: "0", ButtonText: "Назад", BackButton: true}},
+		},
+	}
+}
+
+// настройки только кнопок, Готово показывается после выбора заявки
+func defaultTicketCommentMenuBtnCnf() *Menu {
+	return &Menu{
+		Answer: []*Answer{
+			{Chat: "<ticket_comment_answer>"},
+		},
+		Buttons: []*Buttons{
+			{Button{ButtonID: "1", ButtonText: "Готово", Goto: database.TICKET_COMMENT}},
+			{Button{ButtonID: "0", ButtonText: "Назад", BackButton: true}},
+		},
+	}
+}
+
 func CopyMap(m map[string]*Menu) map[string]*Menu {
 	cp := make(map[string]*Menu)
 	for k, v := range m {
@@ -173,9 +185,11 @@ func nestedToFlat(main *Levels, buttons []*Buttons, k string, depthLevel int) er
 				return fmt.Errorf("уже существует меню с данным id(%s): %s {%s} lvl:%d", b.Button.NestedMenu.ID, k, b.Button.View(), depthLevel)
 			}
 			menu := &Menu{
-				Answer:     b.Button.NestedMenu.Answer,
-				Buttons:    b.Button.NestedMenu.Buttons,
-				QnaDisable: b.Button.NestedMenu.QnaDisable,
+				Answer:        b.Button.NestedMenu.Answer,
+				Buttons:       b.Button.NestedMenu.Buttons,
+				QnaDisable:    b.Button.NestedMenu.QnaDisable,
+				AvailableWhen: b.Button.NestedMenu.AvailableWhen,
+				OffHoursGoto:  b.Button.NestedMenu.OffHoursGoto,
 			}
 			main.Menu[b.Button.NestedMenu.ID] = menu
 			b.Button.Goto = b.Button.NestedMenu.ID
@@ -220,6 +234,8 @@ func (l *Levels) checkMenus() error {
 		l.Menu[database.WAIT_SEND] = defaultWaitSendMenu()
 	}
 	l.Menu[database.CREATE_TICKET] = defaultCreateTicketMenuBtnCnf()
+	l.Menu[database.MY_TICKETS] = defaultMyTicketsMenuBtnCnf()
+	l.Menu[database.TICKET_COMMENT] = defaultTicketCommentMenuBtnCnf()
 
 	if l.UseQNA.Enabled {
 		if _, ok := l.Menu[database.FAIL_QNA]; !ok {
@@ -233,6 +249,25 @@ func (l *Levels) checkMenus() error {
 	// настраиваем текста ошибок по умолчанию которые не настроены
 	l.setDefaultErrorMessages()
 
+	if l.Schedule != nil {
+		if err := l.Schedule.prepare(); err != nil {
+			return fmt.Errorf("schedule: %w", err)
+		}
+	}
+
+	// действие при отсутствии свободных специалистов
+	if l.NoSpecialists != nil {
+		b := &Buttons{Button: *l.NoSpecialists}
+		b.Button.ButtonText = "<no_specialists>"
+		if err := nestedToFlat(l, []*Buttons{b}, "no_specialists", 1); err != nil {
+			return err
+		}
+		if err := l.checkMenuLevels([]*Buttons{b}, "no_specialists", l.Menu[database.START], 1); err != nil {
+			return err
+		}
+		l.NoSpecialists = &b.Button
+	}
+
 	// проверка меню и подуровней
 	for k, v := range l.Menu {
 		if len(v.Buttons) == 0 && v.DoButton == nil {
@@ -243,6 +278,14 @@ func (l *Levels) checkMenus() error {
 			return fmt.Errorf("нельзя использовать одновременно buttons и do_button: %s {%s}", k, v.View())
 		}
 
+		if err := checkAnswersIf(v.Answer); err != nil {
+			return fmt.Errorf("%v: %s {%s}", err, k, v.View())
+		}
+
+		if err := l.checkSchedule(v.AvailableWhen, v.OffHoursGoto); err != nil {
+			return fmt.Errorf("%v: %s {%s}", err, k, v.View())
+		}
+
 		if v.Buttons != nil {
 			err := l.checkMenuLevels(v.Buttons, k, v, 1)
 			if err != nil {
@@ -308,6 +351,25 @@ func (l *Levels) checkButton(b *Buttons, k string, v *Menu, depthLevel int) erro
 		if b.Button.SaveToVar.DoButton.BackButton {
 			return fmt.Errorf("SaveToVar: в do_button нельзя использовать back_button: %s {%s} lvl:%d", k, sBtnView, depthLevel)
 		}
+		if source := b.Button.SaveToVar.OptionsSource; source != nil {
+			if err := source.check(); err != nil {
+				return fmt.Errorf("SaveToVar: options_source: %v: %s {%s} lvl:%d", err, k, sBtnView, depthLevel)
+			}
+		}
+		hasOptions := len(b.Button.SaveToVar.OfferOptions) != 0 || b.Button.SaveToVar.OptionsSource != nil
+		for i, rule := range b.Button.SaveToVar.Validate {
+			if err := rule.check(hasOptions); err != nil {
+				return fmt.Errorf("SaveToVar: validate #%d: %v: %s {%s} lvl:%d", i+1, err, k, sBtnView, depthLevel)
+			}
+		}
+		if _, ok := l.Menu[b.Button.SaveToVar.FailGoto]; b.Button.SaveToVar.FailGoto != "" && !ok {
+			return fmt.Errorf("SaveToVar: fail_goto ведет на несуществующий уровень: %s {%s} lvl:%d", k, sBtnView, depthLevel)
+		}
+		if files := b.Button.SaveToVar.Files; files != nil {
+			if err := files.check(); err != nil {
+				return fmt.Errorf("SaveToVar: files: %v: %s {%s} lvl:%d", err, k, sBtnView, depthLevel)
+			}
+		}
 		modifycatorCount++
 	}
 
@@ -335,7 +397,7 @@ func (l *Levels) checkButton(b *Buttons, k string, v *Menu, depthLevel int) erro
 			if field.Text == "" && field.DefaultValue == nil {
 				return fmt.Errorf("TicketButton: поле (%s) должно содержать text или value: %s {%s} lvl:%d", fieldName, k, tBtnView, depthLevel)
 			}
-			if field.DefaultValue != nil && !slices.Contains([]string{"theme", "description"}, fieldName) {
+			if field.DefaultValue != nil && !slices.Contains([]string{"theme", "description", "priority", "deadline"}, fieldName) {
 				if _, err := uuid.Parse(*field.DefaultValue); err != nil {
 					return fmt.Errorf("TicketButton: value не id (%s): %s {%s} lvl:%d", fieldName, k, tBtnView, depthLevel)
 				}
@@ -359,6 +421,99 @@ func (l *Levels) checkButton(b *Buttons, k string, v *Menu, depthLevel int) erro
 			return err
 		}
 
+		// необязательные шаги
+		if f := tBtn.Data.Fields; f != nil && f.DefaultValue != nil {
+			return fmt.Errorf("TicketButton: для дополнительных полей (fields) нельзя указать value: %s {%s} lvl:%d", k, tBtnView, depthLevel)
+		}
+		if p := tBtn.Data.Priority; p != nil {
+			if err := validateField(p, "priority"); err != nil {
+				return err
+			}
+			if p.DefaultValue != nil && database.TicketPriorityName(*p.DefaultValue) == "" {
+				return fmt.Errorf("TicketButton: value должен быть LOW, STANDARD или HIGH (priority): %s {%s} lvl:%d", k, tBtnView, depthLevel)
+			}
+		}
+		if d := tBtn.Data.Deadline; d != nil {
+			if err := validateField(d, "deadline"); err != nil {
+				return err
+			}
+			if d.DefaultValue != nil {
+				if _, err := ParseDeadline(*d.DefaultValue, time.Now()); err != nil {
+					return fmt.Errorf("TicketButton: %v (deadline): %s {%s} lvl:%d", err, k, tBtnView, depthLevel)
+				}
+			}
+		}
+
+		if tBtn.Files != nil {
+			if err := tBtn.Files.check(); err != nil {
+				return fmt.Errorf("TicketButton: files: %v: %s {%s} lvl:%d", err, k, tBtnView, depthLevel)
+			}
+		}
+		if tBtn.SuccessText == "" {
+			tBtn.SuccessText = "Заявка №{{ .CreatedTicket.Number }} зарегистрирована"
+		}
+		if _, err := template.New("").Parse(tBtn.SuccessText); err != nil {
+			return fmt.Errorf("TicketButton: некорректный шаблон success_text (%v): %s {%s} lvl:%d", err, k, tBtnView, depthLevel)
+		}
+		if tBtn.FileAddedText == "" {
+			tBtn.FileAddedText = "Файл будет прикреплен к заявке"
+		}
+		for _, varName := range tBtn.AttachVars {
+			if varName == "" || varName == database.VAR_FOR_SAVE {
+				return fmt.Errorf("TicketButton: некорректное имя переменной в attach_vars (%s): %s {%s} lvl:%d", varName, k, tBtnView, depthLevel)
+			}
+		}
+		modifycatorCount++
+	}
+
+	if b.Button.MyTicketsButton != nil {
+		if l.MyTicketsButton != nil {
+			b.Button.SetDefault(*l.MyTicketsButton)
+		}
+
+		mBtn := b.Button.MyTicketsButton
+		if mBtn.Text == "" {
+			mBtn.Text = "Ваши открытые заявки:"
+		}
+		if mBtn.EmptyText == "" {
+			mBtn.EmptyText = "У вас нет открытых заявок"
+		}
+		if mBtn.TicketInfo != "" {
+			if _, err := template.New("").Parse(mBtn.TicketInfo); err != nil {
+				return fmt.Errorf("MyTicketsButton: некорректный шаблон ticket_info (%v): %s {%s} lvl:%d", err, k, mBtn.View(), depthLevel)
+			}
+		}
+		modifycatorCount++
+	}
+
+	if b.Button.TicketCommentButton != nil {
+		if l.TicketCommentButton != nil {
+			b.Button.SetDefault(*l.TicketCommentButton)
+		}
+
+		cBtn := b.Button.TicketCommentButton
+		for _, v := range []struct {
+			text         *string
+			defaultValue string
+		}{
+			{&cBtn.Text, "Выберите заявку:"},
+			{&cBtn.EmptyText, "У вас нет открытых заявок"},
+			{&cBtn.SendText, "Напишите сообщение или отправьте файл для заявки №{{ .Ticket.Number }}. Когда закончите, нажмите «Готово»"},
+			{&cBtn.AddedText, "Добавлено в заявку"},
+			{&cBtn.DoneText, "Спасибо, сообщения переданы исполнителю заявки"},
+		} {
+			if *v.text == "" {
+				*v.text = v.defaultValue
+			}
+		}
+		if _, err := template.New("").Parse(cBtn.SendText); err != nil {
+			return fmt.Errorf("TicketCommentButton: некорректный шаблон send_text (%v): %s {%s} lvl:%d", err, k, cBtn.View(), depthLevel)
+		}
+		if cBtn.Files != nil {
+			if err := cBtn.Files.check(); err != nil {
+				return fmt.Errorf("TicketCommentButton: files: %v: %s {%s} lvl:%d", err, k, cBtn.View(), depthLevel)
+			}
+		}
 		modifycatorCount++
 	}
 
@@ -404,11 +559,64 @@ func (l *Levels) checkButton(b *Buttons, k string, v *Menu, depthLevel int) erro
 		}
 		modifycatorCount++
 	}
+	if opts := b.Button.ExecOptions; opts != nil {
+		optsView := opts.View()
+
+		if b.Button.ExecButton == "" {
+			return fmt.Errorf("ExecOptions: exec_options используется без exec_button: %s {%s} lvl:%d", k, b.Button.View(), depthLevel)
+		}
+		if err := opts.check(); err != nil {
+			return fmt.Errorf("ExecOptions: %v: %s {%s} lvl:%d", err, k, optsView, depthLevel)
+		}
+		if _, ok := l.Menu[opts.FailGoto]; opts.FailGoto != "" && !ok {
+			return fmt.Errorf("ExecOptions: fail_goto ведет на несуществующий уровень: %s {%s} lvl:%d", k, optsView, depthLevel)
+		}
+	}
+
+	if b.Button.If != "" {
+		if _, err := ParseCondition(b.Button.If); err != nil {
+			return fmt.Errorf("некорректное условие if (%v): %s {%s} lvl:%d", err, k, b.Button.View(), depthLevel)
+		}
+	}
+	if err := checkAnswersIf(b.Button.Chat); err != nil {
+		return fmt.Errorf("%v: %s {%s} lvl:%d", err, k, b.Button.View(), depthLevel)
+	}
+	for _, v := range b.Button.GotoSwitch {
+		if v.If != "" {
+			if _, err := ParseCondition(v.If); err != nil {
+				return fmt.Errorf("goto_switch: некорректное условие if (%v): %s {%s} lvl:%d", err, k, b.Button.View(), depthLevel)
+			}
+		}
+		if _, ok := l.Menu[v.Goto]; !ok {
+			return fmt.Errorf("goto_switch: кнопка ведет на несуществующий уровень (%s): %s {%s} lvl:%d", v.Goto, k, b.Button.View(), depthLevel)
+		}
+	}
+
+	if b.Button.HttpButton != nil {
+		hBtn := b.Button.HttpButton
+		hBtnView := hBtn.View()
+
+		if err := hBtn.check(); err != nil {
+			return fmt.Errorf("HttpButton: %v: %s {%s} lvl:%d", err, k, hBtnView, depthLevel)
+		}
+		if _, ok := l.Menu[hBtn.FailGoto]; hBtn.FailGoto != "" && !ok {
+			return fmt.Errorf("HttpButton: fail_goto ведет на несуществующий уровень: %s {%s} lvl:%d", k, hBtnView, depthLevel)
+		}
+
+		if l.HttpButton != nil {
+			b.Button.SetDefault(*l.HttpButton)
+		}
+		modifycatorCount++
+	}
+
+	if err := l.checkSchedule(b.Button.AvailableWhen, b.Button.OffHoursGoto); err != nil {
+		return fmt.Errorf("%v: %s {%s} lvl:%d", err, k, b.Button.View(), depthLevel)
+	}
 
 	if modifycatorCount > 1 {
 		return fmt.Errorf("кнопка может иметь только один модификатор: %s {%s} lvl:%d", k, b.Button.View(), depthLevel)
 	}
-	if b.Button.Goto != "" && b.Button.BackButton {
+	if (b.Button.Goto != "" || len(b.Button.GotoSwitch) != 0) && b.Button.BackButton {
 		return fmt.Errorf("back_button не может иметь goto: %s {%s} lvl:%d", k, b.Button.View(), depthLevel)
 	}
 	if _, ok := l.Menu[b.Button.Goto]; b.Button.Goto != "" && !ok && b.Button.Goto != database.CREATE_TICKET_PREV_STAGE {
@@ -423,6 +631,57 @@ func (l *Levels) checkButton(b *Buttons, k string, v *Menu, depthLevel int) erro
 	return nil
 }
 
+// проверить настройки доступности по расписанию
+func (l *Levels) checkSchedule(availableWhen, offHoursGoto string) error {
+	if availableWhen == "" && offHoursGoto == "" {
+		return nil
+	}
+	if l.Schedule == nil {
+		return fmt.Errorf("available_when и off_hours_goto используются без schedule")
+	}
+	if availableWhen != "" && availableWhen != WORKING_HOURS && availableWhen != OFF_HOURS {
+		return fmt.Errorf("некорректный available_when (%s), ожидается %s или %s", availableWhen, WORKING_HOURS, OFF_HOURS)
+	}
+	if _, ok := l.Menu[offHoursGoto]; offHoursGoto != "" && !ok {
+		return fmt.Errorf("off_hours_goto ведет на несуществующий уровень (%s)", offHoursGoto)
+	}
+	return nil
+}
+
+// проверить условия if у сообщений
+func checkAnswersIf(answer []*Answer) error {
+	for _, v := range answer {
+		if v.If == "" {
+			continue
+		}
+		if _, err := ParseCondition(v.If); err != nil {
+			return fmt.Errorf("некорректное условие if у сообщения (%v)", err)
+		}
+	}
+	return nil
+}
+
+// ParseCondition - собрать шаблон условия, условие записывается как содержимое {{ if ... }}
+func ParseCondition(cond string) (*template.Template, error) {
+	cond = strings.TrimSpace(cond)
+	cond = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(cond, "{{"), "}}"))
+	return template.New("if").Option("missingkey=zero").Funcs(conditionFuncs).Parse("{{ if " + cond + " }}true{{ end }}")
+}
+
+// функции доступные в условиях
+var conditionFuncs = template.FuncMap{
+	// in - значение совпадает с одним из перечисленных, сравнение выполняется по строковому представлению
+	"in": func(value any, list ...any) bool {
+		v := fmt.Sprint(value)
+		for _, item := range list {
+			if fmt.Sprint(item) == v {
+				return true
+			}
+		}
+		return false
+	},
+}
+
 // настроить текста ошибок по умолчанию
 func (l *Levels) setDefaultErrorMessages() {
 	var messages = []struct {
@@ -432,12 +691,25 @@ func (l *Levels) setDefaultErrorMessages() {
 		{&l.ErrorMessages.CommandUnknown, "Команда неизвестна. Попробуйте еще раз"},
 		{&l.ErrorMessages.ButtonProcessing, "Во время обработки вашего запроса произошла ошибка"},
 		{&l.ErrorMessages.FailedSendFile, "Ошибка: Не удалось отправить файл"},
+		{&l.ErrorMessages.TemporaryUnavailable, "Сервис временно недоступен. Попробуйте повторить запрос позже"},
 		{&l.ErrorMessages.AppointSpecButton.SelectedSpecNotAvailable, "Выбранный специалист недоступен"},
 		{&l.ErrorMessages.AppointRandomSpecFromListButton.SpecsNotAvailable, "Специалисты данной области недоступны"},
 		{&l.ErrorMessages.RerouteButton.SelectedLineNotAvailable, "Выбранная линия недоступна"},
+		{&l.ErrorMessages.ExecButton.CommandFailed, "Команда завершилась с ошибкой"},
+		{&l.ErrorMessages.ExecButton.Timeout, "Превышено время выполнения команды"},
+		{&l.ErrorMessages.SaveToVar.ReceivedIncorrectValue, "Получено некорректное значение. Повторите попытку"},
+		{&l.ErrorMessages.SaveToVar.RetryLimitExceeded, "Превышено количество попыток ввода"},
+		{&l.ErrorMessages.SaveToVar.FileNotAllowed, "Файл не подходит. Проверьте тип и размер файла"},
 		{&l.ErrorMessages.TicketButton.StepCannotBeSkipped, "Данный этап нельзя пропустить"},
 		{&l.ErrorMessages.TicketButton.ReceivedIncorrectValue, "Получено некорректное значение. Повторите попытку"},
 		{&l.ErrorMessages.TicketButton.ExpectedButtonPress, "Ожидалось нажатие на кнопку. Повторите попытку"},
+		{&l.ErrorMessages.TicketButton.AlreadyRegistered, "Такая заявка уже зарегистрирована"},
+		{&l.ErrorMessages.TicketButton.FileNotAllowed, "Файл не подходит. Проверьте тип и размер файла"},
+		{&l.ErrorMessages.TicketButton.FailedAttachFile, "Не удалось прикрепить файл к заявке"},
+		{&l.ErrorMessages.MyTicketsButton.TicketNotFound, "Заявка не найдена. Выберите заявку из списка"},
+		{&l.ErrorMessages.TicketCommentButton.TicketNotFound, "Заявка не найдена. Выберите заявку из списка"},
+		{&l.ErrorMessages.TicketCommentButton.FailedAddComment, "Не удалось добавить сообщение в заявку. Повторите попытку"},
+		{&l.ErrorMessages.TicketCommentButton.FileNotAllowed, "Файл не подходит. Проверьте тип и размер файла"},
 	}
 
 	for _, v := range messages {
@@ -480,10 +752,13 @@ func Quotes(s string) string {
 	return answer.String()
 }
 
-// GenKeyboard - создать клавиатуру
-func (l *Levels) GenKeyboard(menu string) *[][]requests.KeyboardKey {
+// GenKeyboard - создать клавиатуру, visible - проверка условия отображения кнопки
+func (l *Levels) GenKeyboard(menu string, visible func(*Button) bool) *[][]requests.KeyboardKey {
 	answer := &[][]requests.KeyboardKey{}
 	for _, v := range l.Menu[menu].Buttons {
+		if visible != nil && !visible(&v.Button) {
+			continue
+		}
 		*answer = append(*answer, []requests.KeyboardKey{{ID: v.Button.ButtonID, Text: Quotes(v.Button.ButtonText)}})
 	}
 	if len(*answer) == 0 {
@@ -492,18 +767,15 @@ func (l *Levels) GenKeyboard(menu string) *[][]requests.KeyboardKey {
 	return answer
 }
 
-func (l *Levels) GetButton(menu, text string) *Button {
+// GetButton - найти кнопку по тексту или id, скрытые кнопки не учитываются
+func (l *Levels) GetButton(menu, text string, visible func(*Button) bool) *Button {
 	for _, v := range l.Menu[menu].Buttons {
+		if visible != nil && !visible(&v.Button) {
+			continue
+		}
 		if text == strings.ToLower(strings.TrimSpace(v.Button.ButtonText)) || (v.Button.ButtonID != "" && text == v.Button.ButtonID) {
 			return &v.Button
 		}
 	}
 	return nil
 }
-
-// InjectLevels - Adds a levels to the Gin context
-func InjectLevels(key string, levels *Levels) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Set(key, levels)
-	}
-}
@@ -0,0 +1,150 @@
+package botconfig_parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// когда доступна кнопка или меню
+const (
+	WORKING_HOURS = "working_hours"
+	OFF_HOURS     = "off_hours"
+)
+
+var weekdays = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+type Schedule struct {
+	// часовой пояс, например Europe/Moscow, по умолчанию часовой пояс сервера
+	Timezone string `yaml:"timezone"`
+	// рабочие часы по дням недели (mon, tue, wed, thu, fri, sat, sun): 09:00-18:00 или 09:00-13:00, 14:00-18:00
+	WorkingHours map[string]string `yaml:"working_hours"`
+	// нерабочие дни: 2025-01-01 - конкретная дата, 01-07 - каждый год
+	Holidays []string `yaml:"holidays"`
+
+	location  *time.Location
+	intervals map[time.Weekday][]interval
+	holidays  map[string]struct{}
+}
+
+// интервал рабочего времени в минутах от начала дня
+type interval struct {
+	from, to int
+}
+
+// разобрать настройки расписания
+func (s *Schedule) prepare() error {
+	s.location = time.Local
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("неизвестный часовой пояс (%s)", s.Timezone)
+		}
+		s.location = location
+	}
+
+	s.intervals = make(map[time.Weekday][]interval)
+	for day, hours := range s.WorkingHours {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("неизвестный день недели (%s)", day)
+		}
+		for _, part := range strings.Split(hours, ",") {
+			i, err := parseInterval(strings.TrimSpace(part))
+			if err != nil {
+				return fmt.Errorf("%s: %w", day, err)
+			}
+			s.intervals[weekday] = append(s.intervals[weekday], i)
+		}
+	}
+
+	s.holidays = make(map[string]struct{})
+	for _, date := range s.Holidays {
+		_, errDate := time.Parse(time.DateOnly, date)
+		_, errYearly := time.Parse("01-02", date)
+		if errDate != nil && errYearly != nil {
+			return fmt.Errorf("некорректная дата нерабочего дня (%s)", date)
+		}
+		s.holidays[date] = struct{}{}
+	}
+	return nil
+}
+
+// разобрать интервал вида 09:00-18:00
+func parseInterval(value string) (i interval, err error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return i, fmt.Errorf("некорректный интервал (%s)", value)
+	}
+	if i.from, err = parseClock(from); err != nil {
+		return i, err
+	}
+	if i.to, err = parseClock(to); err != nil {
+		return i, err
+	}
+	if i.to <= i.from {
+		return i, fmt.Errorf("конец интервала должен быть позже начала (%s)", value)
+	}
+	return i, nil
+}
+
+// время вида 09:00 в минутах от начала дня, допускается 24:00
+func parseClock(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("некорректное время (%s)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsWorkingTime - рабочее ли время в указанный момент
+func (s *Schedule) IsWorkingTime(t time.Time) bool {
+	t = t.In(s.location)
+
+	if _, ok := s.holidays[t.Format(time.DateOnly)]; ok {
+		return false
+	}
+	if _, ok := s.holidays[t.Format("01-02")]; ok {
+		return false
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	for _, i := range s.intervals[t.Weekday()] {
+		if minutes >= i.from && minutes < i.to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsWorkingTime - рабочее ли время по расписанию бота, без расписания время всегда рабочее
+func (l *Levels) IsWorkingTime(t time.Time) bool {
+	if l.Schedule == nil {
+		return true
+	}
+	return l.Schedule.IsWorkingTime(t)
+}
+
+// IsAvailable - доступна ли кнопка или меню с настройкой available_when в указанный момент
+func (l *Levels) IsAvailable(availableWhen string, t time.Time) bool {
+	switch availableWhen {
+	case WORKING_HOURS:
+		return l.IsWorkingTime(t)
+	case OFF_HOURS:
+		return !l.IsWorkingTime(t)
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package botconfig_parser
+
+import (
+	"fmt"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// встроенные типы проверки введенного значения
+const (
+	VALIDATE_EMAIL  = "email"
+	VALIDATE_PHONE  = "phone"
+	VALIDATE_INN    = "inn"
+	VALIDATE_NUMBER = "number"
+	VALIDATE_DATE   = "date"
+)
+
+// форматы даты, которые может ввести пользователь
+var dateLayouts = []string{"02.01.2006", "2.1.2006", "02.01.06", "2006-01-02", "02/01/2006"}
+
+var (
+	rePhone  = regexp.MustCompile(`^\+?\d{10,15}$`)
+	reDigits = regexp.MustCompile(`^\d+$`)
+)
+
+type ValidateRule struct {
+	// регулярное выражение, которому должно соответствовать значение
+	Regex string `yaml:"regex,omitempty"`
+	// встроенный тип: email, phone, inn, number, date
+	Type string `yaml:"type,omitempty"`
+	// минимальная длина
+	MinLength int `yaml:"min_length,omitempty"`
+	// максимальная длина
+	MaxLength int `yaml:"max_length,omitempty"`
+	// значение должно быть одним из вариантов offer_options или options_source
+	OneOfOptions bool `yaml:"one_of_options,omitempty"`
+	// текст ошибки
+	ErrorText string `yaml:"error_text,omitempty"`
+	// количество неудачных попыток ввода, после которого ввод прерывается, 0 - без ограничений
+	RetryLimit int `yaml:"retry_limit,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// проверить настройки правила, hasOptions - у save_to_var есть варианты ответа
+func (r *ValidateRule) check(hasOptions bool) error {
+	if r.Regex == "" && r.Type == "" && r.MinLength == 0 && r.MaxLength == 0 && !r.OneOfOptions {
+		return fmt.Errorf("правило не содержит проверок")
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("некорректное регулярное выражение (%v)", err)
+		}
+		r.re = re
+	}
+	if r.Type != "" && !slices.Contains([]string{VALIDATE_EMAIL, VALIDATE_PHONE, VALIDATE_INN, VALIDATE_NUMBER, VALIDATE_DATE}, r.Type) {
+		return fmt.Errorf("неизвестный тип (%s)", r.Type)
+	}
+	if r.MinLength < 0 || r.MaxLength < 0 || (r.MaxLength != 0 && r.MinLength > r.MaxLength) {
+		return fmt.Errorf("некорректные min_length и max_length")
+	}
+	if r.OneOfOptions && !hasOptions {
+		return fmt.Errorf("one_of_options используется без offer_options и options_source")
+	}
+	if r.RetryLimit < 0 {
+		return fmt.Errorf("некорректный retry_limit")
+	}
+	return nil
+}
+
+// Validate - проверить значение, options - заполненные варианты offer_options и options_source
+func (r *ValidateRule) Validate(value string, options []string) bool {
+	value = strings.TrimSpace(value)
+
+	length := utf8.RuneCountInString(value)
+	if r.MinLength != 0 && length < r.MinLength {
+		return false
+	}
+	if r.MaxLength != 0 && length > r.MaxLength {
+		return false
+	}
+
+	if r.Regex != "" {
+		// правило могло быть восстановлено из хранилища без скомпилированного выражения
+		if r.re == nil {
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return false
+			}
+			r.re = re
+		}
+		if !r.re.MatchString(value) {
+			return false
+		}
+	}
+
+	if r.OneOfOptions && !slices.ContainsFunc(options, func(option string) bool {
+		return strings.EqualFold(strings.TrimSpace(option), value)
+	}) {
+		return false
+	}
+
+	switch r.Type {
+	case VALIDATE_EMAIL:
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case VALIDATE_PHONE:
+		return rePhone.MatchString(strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(value))
+	case VALIDATE_INN:
+		return isValidINN(value)
+	case VALIDATE_NUMBER:
+		_, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+		return err == nil
+	case VALIDATE_DATE:
+		for _, layout := range dateLayouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// проверить ИНН юр. лица (10 цифр) или физ. лица (12 цифр) по контрольным числам
+func isValidINN(inn string) bool {
+	if !reDigits.MatchString(inn) {
+		return false
+	}
+
+	digits := make([]int, len(inn))
+	for i, c := range inn {
+		digits[i] = int(c - '0')
+	}
+
+	checksum := func(weights []int) int {
+		sum := 0
+		for i, w := range weights {
+			sum += digits[i] * w
+		}
+		return sum % 11 % 10
+	}
+
+	switch len(digits) {
+	case 10:
+		return checksum([]int{2, 4, 10, 3, 5, 9, 4, 6, 8}) == digits[9]
+	case 12:
+		return checksum([]int{7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) == digits[10] &&
+			checksum([]int{3, 7, 2, 4, 10, 3, 5, 9, 4, 6, 8}) == digits[11]
+	}
+	return false
+}
+
+// FileRules - какие файлы принимаются от пользователя
+type FileRules struct {
+	// допустимые расширения файлов, например [png, pdf], если не указаны то любые
+	Extensions []string `yaml:"extensions,omitempty"`
+	// максимальный размер файла в байтах, 0 - без ограничений
+	MaxSize int64 `yaml:"max_size,omitempty"`
+}
+
+// проверить настройки и привести расширения к виду .ext
+func (r *FileRules) check() error {
+	if r.MaxSize < 0 {
+		return fmt.Errorf("некорректный max_size")
+	}
+	for i, ext := range r.Extensions {
+		ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+		if ext == "" {
+			return fmt.Errorf("пустое расширение файла")
+		}
+		r.Extensions[i] = "." + ext
+	}
+	return nil
+}
+
+// Allowed - файл подходит по расширению и размеру, если правила не заданы то подходит любой файл
+// при заданном max_size файл с неизвестным размером (0) не подходит
+func (r *FileRules) Allowed(name string, size int64) bool {
+	if r == nil {
+		return true
+	}
+	if r.MaxSize != 0 && (size <= 0 || size > r.MaxSize) {
+		return false
+	}
+	return len(r.Extensions) == 0 || slices.Contains(r.Extensions, strings.ToLower(filepath.Ext(name)))
+}
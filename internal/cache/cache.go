@@ -5,17 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"slices"
+	"time"
 
 	"connect-text-bot/internal/botconfig_parser"
 	"connect-text-bot/internal/connect/client"
+	"connect-text-bot/internal/connect/response"
 	"connect-text-bot/internal/database"
 	"connect-text-bot/internal/logger"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/google/uuid"
 )
 
-func (chatState *Chat) ChangeCache(cache *bigcache.BigCache, userID, lineID uuid.UUID) error {
+func (chatState *Chat) ChangeCache(cache database.StateStore, userID, lineID uuid.UUID) error {
 	data, err := json.Marshal(chatState)
 	if err != nil {
 		logger.Warning("Error while change state to cache", err)
@@ -33,7 +34,7 @@ func (chatState *Chat) ChangeCache(cache *bigcache.BigCache, userID, lineID uuid
 	return nil
 }
 
-func (chatState *Chat) ChangeCacheTicket(cache *bigcache.BigCache, userID, lineID uuid.UUID, key string, value database.TicketPart) error {
+func (chatState *Chat) ChangeCacheTicket(cache database.StateStore, userID, lineID uuid.UUID, key string, value database.TicketPart) error {
 	t := database.Ticket{}
 
 	switch key {
@@ -64,14 +65,53 @@ func (chatState *Chat) ChangeCacheTicket(cache *bigcache.BigCache, userID, lineI
 		case t.GetServiceType():
 			chatState.Ticket.ServiceType = value
 		}
+	case t.GetPriority():
+		if value.Name == nil {
+			return fmt.Errorf("не передан Name для: %s", key)
+		}
+		if *value.Name != "" && database.TicketPriorityName(*value.Name) == "" {
+			return fmt.Errorf("не корректный приоритет: %s", *value.Name)
+		}
+		chatState.Ticket.Priority = *value.Name
 	default:
-		return fmt.Errorf("не корректный ключ: %s", key)
+		field, ok := chatState.Ticket.FieldByStage(key)
+		if !ok {
+			return fmt.Errorf("не корректный ключ: %s", key)
+		}
+		if value.Name == nil {
+			return fmt.Errorf("не передан Name для: %s", key)
+		}
+		field.Value = *value.Name
 	}
 
 	return chatState.ChangeCache(cache, userID, lineID)
 }
 
-func (chatState *Chat) ChangeCacheVars(cache *bigcache.BigCache, userID, lineID uuid.UUID, key, value string) error {
+// сохранить дополнительные поля выбранного типа заявки, значения полей сбрасываются
+func (chatState *Chat) ChangeCacheTicketFields(cache database.StateStore, userID, lineID uuid.UUID, fields []response.TicketDataAdditionalField) error {
+	chatState.Ticket.Fields = make([]database.TicketField, 0, len(fields))
+	for _, f := range fields {
+		chatState.Ticket.Fields = append(chatState.Ticket.Fields, database.TicketField{ID: f.ID, Name: f.Name})
+	}
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+// начать новый черновик заявки
+func (chatState *Chat) ChangeCacheTicketDraft(cache database.StateStore, userID, lineID uuid.UUID, draftID uuid.UUID) error {
+	chatState.Ticket.DraftID = draftID
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+// сохранить срок заявки, нулевое значение - срок не задан
+func (chatState *Chat) ChangeCacheTicketDeadline(cache database.StateStore, userID, lineID uuid.UUID, deadline time.Time) error {
+	chatState.Ticket.Deadline = deadline
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+func (chatState *Chat) ChangeCacheVars(cache database.StateStore, userID, lineID uuid.UUID, key, value string) error {
 	if chatState.Vars == nil {
 		chatState.Vars = make(map[string]string)
 	}
@@ -80,13 +120,74 @@ func (chatState *Chat) ChangeCacheVars(cache *bigcache.BigCache, userID, lineID
 	return chatState.ChangeCache(cache, userID, lineID)
 }
 
-func (chatState *Chat) ChangeCacheSavedButton(cache *bigcache.BigCache, userID, lineID uuid.UUID, button *botconfig_parser.Button) error {
+// сохранить файл в переменную, в самой переменной остается имя файла
+func (chatState *Chat) ChangeCacheFile(cache database.StateStore, userID, lineID uuid.UUID, varName string, file database.File) error {
+	if chatState.Files == nil {
+		chatState.Files = make(map[string]database.File)
+	}
+	chatState.Files[varName] = file
+
+	return chatState.ChangeCacheVars(cache, userID, lineID, varName, file.Name)
+}
+
+// удалить файлы из переменных: туда сохраняется текст или файлы уже прикреплены к заявке
+func (chatState *Chat) DeleteCacheFile(cache database.StateStore, userID, lineID uuid.UUID, varNames ...string) error {
+	changed := false
+	for _, varName := range varNames {
+		if _, ok := chatState.Files[varName]; ok {
+			delete(chatState.Files, varName)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+// сохранить варианты save_to_var и номер показанной страницы
+func (chatState *Chat) ChangeCacheOptions(cache database.StateStore, userID, lineID uuid.UUID, options []database.Option, page int) error {
+	chatState.Options = options
+	chatState.OptionsPage = page
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+// добавить файл к заполняемой заявке
+func (chatState *Chat) ChangeCacheTicketFile(cache database.StateStore, userID, lineID uuid.UUID, file database.File) error {
+	chatState.Ticket.Files = append(chatState.Ticket.Files, file)
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+func (chatState *Chat) ChangeCacheSavedButton(cache database.StateStore, userID, lineID uuid.UUID, button *botconfig_parser.Button) error {
 	chatState.SavedButton = button
 
 	return chatState.ChangeCache(cache, userID, lineID)
 }
 
-func (chatState *Chat) ChangeCacheState(cache *bigcache.BigCache, userID, lineID uuid.UUID, toState string) error {
+// сохранить зарегистрированную заявку для шаблонов success_text
+func (chatState *Chat) ChangeCacheCreatedTicket(cache database.StateStore, userID, lineID uuid.UUID, ticket *response.Ticket) error {
+	chatState.CreatedTicket = ticket
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+// сохранить заявку, в которую пользователь отправляет сообщения
+func (chatState *Chat) ChangeCacheCommentTicket(cache database.StateStore, userID, lineID uuid.UUID, ticket *response.Ticket) error {
+	chatState.CommentTicket = ticket
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+func (chatState *Chat) ChangeCacheFailedInputs(cache database.StateStore, userID, lineID uuid.UUID, count int) error {
+	chatState.FailedInputs = count
+
+	return chatState.ChangeCache(cache, userID, lineID)
+}
+
+func (chatState *Chat) ChangeCacheState(cache database.StateStore, userID, lineID uuid.UUID, toState string) error {
 	if chatState.CurrentState == toState {
 		return nil
 	}
@@ -103,18 +204,22 @@ func (chatState *Chat) ChangeCacheState(cache *bigcache.BigCache, userID, lineID
 }
 
 // чистим необязательные поля хранимых данных
-func (chatState *Chat) ClearCacheOmitemptyFields(cache *bigcache.BigCache, userID, lineID uuid.UUID) error {
+func (chatState *Chat) ClearCacheOmitemptyFields(cache database.StateStore, userID, lineID uuid.UUID) error {
 	if _, exist := chatState.Vars[database.VAR_FOR_SAVE]; exist {
 		chatState.Vars[database.VAR_FOR_SAVE] = ""
 	}
 	chatState.SavedButton = nil
+	chatState.FailedInputs = 0
+	chatState.Options = nil
+	chatState.OptionsPage = 0
 	chatState.Ticket = database.Ticket{}
+	chatState.CommentTicket = nil
 
 	return chatState.ChangeCache(cache, userID, lineID)
 }
 
 // сохранить данные о пользователе в кеше
-func (chatState *Chat) SaveUserDataInCache(cl *client.Client, ctx context.Context, cache *bigcache.BigCache, userID, lineID uuid.UUID) (err error) {
+func (chatState *Chat) SaveUserDataInCache(cl *client.Client, ctx context.Context, cache database.StateStore, userID, lineID uuid.UUID) (err error) {
 	// получаем данные о пользователе
 	userData, err := cl.GetSubscriber(ctx, userID)
 	if err != nil {
@@ -127,7 +232,7 @@ func (chatState *Chat) SaveUserDataInCache(cl *client.Client, ctx context.Contex
 }
 
 // вернуться на предыдущий пункт меню в истории
-func (chatState *Chat) HistoryStateBack(cache *bigcache.BigCache, userID, lineID uuid.UUID) error {
+func (chatState *Chat) HistoryStateBack(cache database.StateStore, userID, lineID uuid.UUID) error {
 	// если истории нет то мы в старт должны быть
 	if len(chatState.HistoryState) == 0 {
 		chatState.PreviousState = database.GREETINGS
@@ -149,14 +254,14 @@ func (chatState *Chat) HistoryStateBack(cache *bigcache.BigCache, userID, lineID
 }
 
 // добавить новый пункт меню в историю
-func (chatState *Chat) HistoryStateAppend(cache *bigcache.BigCache, userID, lineID uuid.UUID, state string) error {
+func (chatState *Chat) HistoryStateAppend(cache database.StateStore, userID, lineID uuid.UUID, state string) error {
 	// чистим историю если меню последнее должно быть
 	if slices.Contains([]string{database.FAIL_QNA, database.FINAL, database.START, database.GREETINGS}, state) {
 		return chatState.HistoryStateClear(cache, userID, lineID)
 	}
 
 	// игнорируем добавление если спец кнопка
-	if slices.Contains([]string{database.CREATE_TICKET, database.CREATE_TICKET_PREV_STAGE, database.WAIT_SEND}, state) {
+	if slices.Contains([]string{database.CREATE_TICKET, database.CREATE_TICKET_PREV_STAGE, database.WAIT_SEND, database.MY_TICKETS, database.TICKET_COMMENT}, state) {
 		return nil
 	}
 
@@ -169,7 +274,7 @@ func (chatState *Chat) HistoryStateAppend(cache *bigcache.BigCache, userID, line
 }
 
 // очистить историю и необязательные поля
-func (chatState *Chat) HistoryStateClear(cache *bigcache.BigCache, userID, lineID uuid.UUID) error {
+func (chatState *Chat) HistoryStateClear(cache database.StateStore, userID, lineID uuid.UUID) error {
 	chatState.HistoryState = []string{}
 
 	return chatState.ClearCacheOmitemptyFields(cache, userID, lineID)
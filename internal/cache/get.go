@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"connect-text-bot/internal/botconfig_parser"
 	"connect-text-bot/internal/connect/client"
@@ -11,18 +12,17 @@ import (
 	"connect-text-bot/internal/database"
 	"connect-text-bot/internal/logger"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/google/uuid"
 )
 
-func GetState(cl *client.Client, ctx context.Context, cache *bigcache.BigCache, userID, lineID uuid.UUID) Chat {
+func GetState(cl *client.Client, ctx context.Context, cache database.StateStore, userID, lineID uuid.UUID) Chat {
 	var chatState Chat
 
 	dbStateKey := userID.String() + ":" + lineID.String()
 
 	b, err := cache.Get(dbStateKey)
 	if err != nil {
-		if errors.Is(err, bigcache.ErrEntryNotFound) {
+		if errors.Is(err, database.ErrEntryNotFound) {
 			logger.Info("No state in cache for " + userID.String() + ":" + lineID.String())
 			chatState = Chat{
 				PreviousState: database.GREETINGS,
@@ -65,3 +65,29 @@ func (chatState *Chat) GetCacheTicket() database.Ticket {
 func (chatState *Chat) GetCacheSavedButton() *botconfig_parser.Button {
 	return chatState.SavedButton
 }
+
+// найти состояние пользователя, в отличие от GetState новое состояние не создается
+func FindState(cache database.StateStore, userID, lineID uuid.UUID) (chatState Chat, err error) {
+	b, err := cache.Get(userID.String() + ":" + lineID.String())
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &chatState)
+	return
+}
+
+// удалить состояние пользователя, при следующем событии диалог начнется заново
+func DeleteState(cache database.StateStore, userID, lineID uuid.UUID) error {
+	return cache.Delete(userID.String() + ":" + lineID.String())
+}
+
+// разобрать ключ состояния вида userID:lineID, ключи другого вида пропускаются
+func ParseStateKey(key string) (userID, lineID uuid.UUID, ok bool) {
+	user, line, found := strings.Cut(key, ":")
+	if !found {
+		return
+	}
+	userID, errUser := uuid.Parse(user)
+	lineID, errLine := uuid.Parse(line)
+	return userID, lineID, errUser == nil && errLine == nil
+}
@@ -20,9 +20,20 @@ type (
 
 		// хранимые данные
 		Vars map[string]string `json:"vars" binding:"omitempty"`
+		// файлы, сохраненные save_to_var, по имени переменной
+		Files map[string]database.File `json:"files,omitempty"`
 		// хранимые данные о заявке
 		Ticket database.Ticket `json:"ticket" binding:"omitempty"`
 		// кнопка которую необходимо сохранить для последующей работы
 		SavedButton *botconfig_parser.Button `json:"saved_button" binding:"omitempty"`
+		// количество неудачных попыток ввода значения для save_to_var
+		FailedInputs int `json:"failed_inputs,omitempty"`
+		// варианты из options_source и показанная страница
+		Options     []database.Option `json:"options,omitempty"`
+		OptionsPage int               `json:"options_page,omitempty"`
+		// заявка, в которую пользователь отправляет сообщения и файлы
+		CommentTicket *response.Ticket `json:"comment_ticket,omitempty"`
+		// последняя зарегистрированная пользователем заявка, данные из 1С-Коннект
+		CreatedTicket *response.Ticket `json:"created_ticket,omitempty"`
 	}
 )
@@ -1,6 +1,11 @@
 package config
 
 import (
+	"time"
+
+	"connect-text-bot/internal/connect/client"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/events"
 	"connect-text-bot/internal/us"
 
 	"github.com/gin-gonic/gin"
@@ -17,16 +22,57 @@ type (
 		ConnectServer ConnectServer `yaml:"connect_server"`
 		UsServer      us.UsServer   `yaml:"us_server"`
 
-		FilesDir        string      `yaml:"files_dir"`
-		BotConfig       string      `yaml:"bot_config"`
-		SpecID          *uuid.UUID  `yaml:"spec_id"`
-		GeneralSettings bool        `yaml:"use_general_settings"`
-		Line            []uuid.UUID `yaml:"line"`
+		StateStore database.StateStoreConfig `yaml:"state_store"`
+		// защита от повторной обработки событий
+		Dedup database.DedupConfig `yaml:"dedup"`
+
+		// журнал событий диалогов
+		EventLog events.Config `yaml:"event_log"`
+
+		// очередь обработки событий
+		Dispatcher Dispatcher `yaml:"dispatcher"`
+
+		// API администратора для просмотра и сброса состояний пользователей
+		Admin Admin `yaml:"admin"`
+
+		FilesDir        string     `yaml:"files_dir"`
+		BotConfig       string     `yaml:"bot_config"`
+		SpecID          *uuid.UUID `yaml:"spec_id"`
+		GeneralSettings bool       `yaml:"use_general_settings"`
+		Line            []Line     `yaml:"line"`
+	}
+
+	// линия поддержки, на которой работает бот
+	Line struct {
+		ID uuid.UUID `yaml:"id"`
+		// путь к конфигу бота для линии, если не указан то используется общий конфиг
+		BotConfig string `yaml:"bot_config"`
 	}
 
 	Server struct {
 		Host   string `yaml:"host"`
 		Listen string `yaml:"listen"`
+
+		// секрет, который добавляется в адрес hook и проверяется при получении событий
+		HookSecret string `yaml:"hook_secret"`
+		// адреса и подсети, с которых принимаются события, если не указаны то с любых
+		AllowedIPs []string `yaml:"allowed_ips"`
+		// адреса прокси, которым можно доверять заголовок X-Forwarded-For
+		TrustedProxies []string `yaml:"trusted_proxies"`
+
+		// сертификат и ключ для приема запросов по https
+		TLSCert string `yaml:"tls_cert"`
+		TLSKey  string `yaml:"tls_key"`
+	}
+
+	// доступ к API администратора, если токен не задан то API выключено
+	Admin struct {
+		// токен, который передается в заголовке Authorization: Bearer <token>
+		Token string `yaml:"token"`
+		// адреса и подсети, с которых доступно API, если не указаны то с любых
+		AllowedIPs []string `yaml:"allowed_ips"`
+		// сколько получателей рассылки обрабатывать в секунду, по умолчанию 5
+		BroadcastRate float64 `yaml:"broadcast_rate"`
 	}
 
 	Connect struct {
@@ -34,11 +80,57 @@ type (
 		Password string `yaml:"password"`
 	}
 
+	// события одного пользователя обрабатываются по очереди, разных пользователей параллельно
+	Dispatcher struct {
+		// сколько пользователей обрабатывается одновременно, по умолчанию 64
+		Workers int `yaml:"workers"`
+		// сколько событий может ожидать обработки, при превышении новые события отклоняются, по умолчанию 1000
+		QueueSize int `yaml:"queue_size"`
+		// сколько ждать обработки принятых событий при остановке бота, по умолчанию 30s
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	}
+
 	ConnectServer struct {
 		Addr string `yaml:"addr"`
+		// повтор запросов при временных ошибках
+		Retry client.RetryConfig `yaml:"retry"`
+		// прекращение запросов после серии ошибок, отдельно для каждой линии
+		CircuitBreaker client.BreakerConfig `yaml:"circuit_breaker"`
 	}
 )
 
+func (d *Dispatcher) SetDefault() {
+	if d.Workers <= 0 {
+		d.Workers = 64
+	}
+	if d.QueueSize <= 0 {
+		d.QueueSize = 1000
+	}
+	if d.ShutdownTimeout <= 0 {
+		d.ShutdownTimeout = 30 * time.Second
+	}
+}
+
+// линия может быть задана только id или блоком с id и bot_config
+func (l *Line) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var id uuid.UUID
+	if err := unmarshal(&id); err == nil {
+		l.ID = id
+		return nil
+	}
+
+	type plain Line
+	return unmarshal((*plain)(l))
+}
+
+// получить путь к конфигу бота для линии
+func (cnf *Conf) LineBotConfig(line Line) string {
+	if line.BotConfig != "" {
+		return line.BotConfig
+	}
+	return cnf.BotConfig
+}
+
 func Inject(key string, cnf *Conf) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set(key, cnf)
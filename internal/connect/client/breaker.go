@@ -0,0 +1,62 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// прекращает запросы после серии временных ошибок подряд, через open_timeout пропускает один пробный запрос
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(cnf BreakerConfig) *circuitBreaker {
+	if cnf.FailureThreshold == 0 {
+		cnf.FailureThreshold = 5
+	}
+	if cnf.OpenTimeout <= 0 {
+		cnf.OpenTimeout = 30 * time.Second
+	}
+	return &circuitBreaker{
+		threshold:   cnf.FailureThreshold,
+		openTimeout: cnf.OpenTimeout,
+	}
+}
+
+// можно ли выполнить запрос
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold < 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.openTimeout {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// учесть результат запроса, failed - временная ошибка
+func (b *circuitBreaker) done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.threshold >= 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
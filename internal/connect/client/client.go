@@ -13,6 +13,7 @@ import (
 
 	"connect-text-bot/internal/connect/requests"
 	"connect-text-bot/internal/logger"
+	"connect-text-bot/internal/metrics"
 
 	"github.com/google/uuid"
 )
@@ -29,6 +30,9 @@ type (
 
 		specID *uuid.UUID
 
+		retry   RetryConfig
+		breaker *circuitBreaker
+
 		cl *http.Client
 	}
 
@@ -51,6 +55,9 @@ func New(lineID uuid.UUID, server_addr, login, password string, generalSettings
 
 		specID: specID,
 
+		retry:   RetryConfig{}.withDefaults(),
+		breaker: newCircuitBreaker(BreakerConfig{}),
+
 		cl: &http.Client{
 			Timeout: 10 * time.Second,
 			Transport: &http.Transport{
@@ -63,6 +70,17 @@ func New(lineID uuid.UUID, server_addr, login, password string, generalSettings
 	}
 }
 
+// SetTransport - заменить транспорт http клиента, например для работы без подключения к 1С-Коннект
+func (c *Client) SetTransport(transport http.RoundTripper) {
+	c.cl.Transport = transport
+}
+
+// SetRetry - настроить повтор запросов и прекращение запросов после серии ошибок
+func (c *Client) SetRetry(retry RetryConfig, breaker BreakerConfig) {
+	c.retry = retry.withDefaults()
+	c.breaker = newCircuitBreaker(breaker)
+}
+
 func (e *HttpError) Error() string {
 	return fmt.Sprintf("Http request failed for %s with code %d and message:\n%s", e.Url, e.Code, e.Message)
 }
@@ -85,6 +103,7 @@ func (c *Client) DeleteHook() ([]byte, error) {
 	return c.Invoke(context.Background(), http.MethodDelete, "/hook/bot/"+c.lineID.String()+"/", nil, "application/json", nil)
 }
 
+// Invoke - выполнить запрос к API 1С-Коннект, при временных ошибках запросы, которые можно повторить, повторяются
 func (c *Client) Invoke(ctx context.Context, method string, methodUrl string, urlParams url.Values, contentType string, body []byte) (content []byte, err error) {
 	methodUrl = strings.Trim(methodUrl, "/")
 	reqUrl := c.serverAddr + "/v1/" + methodUrl + "/"
@@ -92,9 +111,43 @@ func (c *Client) Invoke(ctx context.Context, method string, methodUrl string, ur
 		reqUrl += "?" + urlParams.Encode()
 	}
 
-	req, err := http.NewRequest(method, reqUrl, bytes.NewBuffer(body))
+	retryable := isRetryable(method, methodUrl)
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			return nil, fmt.Errorf("%w: %s %s", ErrCircuitOpen, method, reqUrl)
+		}
+
+		var retryAfter time.Duration
+		content, retryAfter, err = c.do(ctx, method, methodUrl, reqUrl, contentType, body)
+		transient := IsTransient(err) && ctx.Err() == nil
+		c.breaker.done(transient)
+
+		if !transient || !retryable || attempt >= c.retry.MaxAttempts {
+			return content, err
+		}
+
+		// ждем не меньше чем просит сервер, но не дольше max_backoff
+		delay := c.retry.backoff(attempt)
+		if retryAfter > c.retry.MaxBackoff {
+			return content, err
+		}
+		delay = max(delay, retryAfter)
+
+		logger.Warning("Повтор запроса", method, reqUrl, "через", delay, ":", err)
+		select {
+		case <-ctx.Done():
+			return content, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// одна попытка запроса, возвращает также паузу из заголовка Retry-After
+func (c *Client) do(ctx context.Context, method, methodUrl, reqUrl, contentType string, body []byte) (content []byte, retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqUrl, bytes.NewBuffer(body))
 	if err != nil {
 		logger.Warning("Error while create request for", reqUrl, "with method", method, ":", err)
+		return nil, 0, err
 	}
 
 	req.SetBasicAuth(c.login, c.password)
@@ -102,11 +155,14 @@ func (c *Client) Invoke(ctx context.Context, method string, methodUrl string, ur
 
 	logger.Debug("---> request", req.Method, reqUrl)
 
+	start := time.Now()
 	resp, err := c.cl.Do(req)
 	if err != nil {
-		return nil, err
+		metrics.ConnectRequest(methodUrl, 0, time.Since(start))
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
+	metrics.ConnectRequest(methodUrl, resp.StatusCode, time.Since(start))
 
 	content, err = io.ReadAll(resp.Body)
 	logger.Debug("<--- request", req.Method, reqUrl, "with body", content)
@@ -120,8 +176,8 @@ func (c *Client) Invoke(ctx context.Context, method string, methodUrl string, ur
 			Code:    resp.StatusCode,
 			Message: string(content),
 		}
-		return
+		return content, parseRetryAfter(resp.Header.Get("Retry-After")), err
 	}
 
-	return
+	return content, 0, err
 }
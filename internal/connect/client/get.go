@@ -85,3 +85,9 @@ func (c Client) GetSpecialists(ctx context.Context, lineID uuid.UUID) (content r
 	err = json.Unmarshal(r, &content)
 	return
 }
+
+// Получить содержимое файла, который отправил пользователь.
+// Метод не описан в документации API 1С-Коннект, адрес нужно сверить с используемой версией
+func (c Client) GetFile(ctx context.Context, fileID uuid.UUID) ([]byte, error) {
+	return c.Invoke(ctx, http.MethodGet, "/line/file/"+fileID.String()+"/", nil, "application/json", nil)
+}
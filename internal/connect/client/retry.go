@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+type (
+	// RetryConfig - повтор запросов к API 1С-Коннект при временных ошибках
+	RetryConfig struct {
+		// количество попыток, 1 - без повторов, по умолчанию 3
+		MaxAttempts int `yaml:"max_attempts"`
+		// пауза перед первым повтором, далее удваивается, по умолчанию 500ms
+		InitialBackoff time.Duration `yaml:"initial_backoff"`
+		// максимальная пауза между попытками, по умолчанию 5s
+		MaxBackoff time.Duration `yaml:"max_backoff"`
+	}
+
+	// BreakerConfig - прекращение запросов к API 1С-Коннект после серии ошибок
+	BreakerConfig struct {
+		// количество ошибок подряд, после которого запросы не выполняются, -1 - не прекращать, по умолчанию 5
+		FailureThreshold int `yaml:"failure_threshold"`
+		// через сколько выполнить пробный запрос, по умолчанию 30s
+		OpenTimeout time.Duration `yaml:"open_timeout"`
+	}
+)
+
+// запросы POST, которые можно повторять: отправка сообщений и запросы без изменения обращения
+var retryablePost = map[string]bool{
+	"hook":               true,
+	"line/send/message":  true,
+	"line/send/file":     true,
+	"line/send/image":    true,
+	"line/drop/keyboard": true,
+	"line/qna":           true,
+}
+
+// ErrCircuitOpen - запрос не выполнен, так как API 1С-Коннект недавно несколько раз подряд вернуло ошибку
+var ErrCircuitOpen = errors.New("API 1С-Коннект временно недоступно")
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 3
+	}
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = 500 * time.Millisecond
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 5 * time.Second
+	}
+	return r
+}
+
+// пауза перед повтором attempt, экспоненциально растет и случайно уменьшается до половины
+func (r RetryConfig) backoff(attempt int) time.Duration {
+	d := r.InitialBackoff << (attempt - 1)
+	if d <= 0 || d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// можно ли повторить запрос без риска выполнить действие дважды
+func isRetryable(method, methodUrl string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return retryablePost[methodUrl]
+	}
+	return false
+}
+
+// Temporary - ошибка временная и запрос имеет смысл повторить
+func (e *HttpError) Temporary() bool {
+	switch e.Code {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// IsTransient - временная ошибка API 1С-Коннект: нет ответа, сервис перегружен или недоступен
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// соединение сброшено, не установлено или ответ оборван,
+	// ошибки DNS, TLS и некорректного адреса не исправятся повтором
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// время из заголовка Retry-After: количество секунд или дата
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
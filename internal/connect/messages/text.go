@@ -32,6 +32,12 @@ type (
 		Text          string      `json:"text" example:"Привет"`
 		Data          struct {
 			Redirect string `json:"redirect"`
+			// файл сообщения MESSAGE_FILE. Имена полей не описаны в документации API 1С-Коннект,
+			// поэтому файл без id, имени или размера бот не принимает
+			FileID   uuid.UUID `json:"file_id,omitempty"`
+			FileName string    `json:"file_name,omitempty"`
+			// размер файла в байтах, 0 - неизвестен
+			FileSize int64 `json:"file_size,omitempty"`
 		} `json:"data"`
 	}
 
@@ -0,0 +1,175 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"connect-text-bot/internal/connect/requests"
+	"connect-text-bot/internal/connect/response"
+
+	"github.com/google/uuid"
+)
+
+// имитация методов API 1С-Коннект, которые использует бот
+func (s *Server) handleApi(method, path, contentType string, body []byte) (int, []byte) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case method == http.MethodPost && path == "/hook/":
+		var r requests.HookSetupRequest
+		if err := json.Unmarshal(body, &r); err != nil {
+			return http.StatusBadRequest, nil
+		}
+		s.mu.Lock()
+		s.hooks[r.ID] = r.Url
+		s.mu.Unlock()
+
+	case method == http.MethodDelete && len(parts) == 3 && parts[0] == "hook":
+		lineID, err := uuid.Parse(parts[2])
+		if err != nil {
+			return http.StatusBadRequest, nil
+		}
+		s.mu.Lock()
+		delete(s.hooks, lineID)
+		s.mu.Unlock()
+
+	case method == http.MethodPost && path == "/line/send/message/":
+		var r requests.MessageRequest
+		if err := json.Unmarshal(body, &r); err != nil {
+			return http.StatusBadRequest, nil
+		}
+		s.record(Message{LineID: r.LineID, UserID: r.UserID, Text: r.Text, Keyboard: flatKeyboard(r.Keyboard)})
+
+	case method == http.MethodPost && (path == "/line/send/file/" || path == "/line/send/image/"):
+		var r requests.FileRequest
+		if err := decodeFileMeta(contentType, body, &r); err != nil {
+			return http.StatusBadRequest, nil
+		}
+		comment := ""
+		if r.Comment != nil {
+			comment = *r.Comment
+		}
+		s.record(Message{LineID: r.LineID, UserID: r.UserID, Text: comment, File: r.FileName, Keyboard: flatKeyboard(r.Keyboard)})
+
+	case method == http.MethodPost && path == "/line/drop/keyboard/":
+
+	case method == http.MethodPost && path == "/line/drop/treatment/":
+		var r requests.TreatmentRequest
+		_ = json.Unmarshal(body, &r)
+		s.record(Message{LineID: r.LineID, UserID: r.UserID, Action: "обращение закрыто"})
+
+	case method == http.MethodPost && path == "/line/appoint/start/":
+		var r requests.TreatmentRequest
+		_ = json.Unmarshal(body, &r)
+		s.record(Message{LineID: r.LineID, UserID: r.UserID, Action: "обращение переведено на свободного специалиста"})
+
+	case method == http.MethodPost && path == "/line/appoint/spec/":
+		var r requests.TreatmentWithSpecRequest
+		_ = json.Unmarshal(body, &r)
+		s.record(Message{LineID: r.LineID, UserID: r.UserID, Action: "обращение переведено на специалиста " + r.SpecID.String()})
+
+	case method == http.MethodPost && path == "/line/reroute/":
+		var r requests.TreatmentRerouteRequest
+		_ = json.Unmarshal(body, &r)
+		s.record(Message{LineID: r.LineID, UserID: r.UserID, Action: "обращение переведено на линию " + r.ToLineID.String()})
+
+	case method == http.MethodPost && path == "/line/qna/":
+		return http.StatusOK, []byte(`{"answers":[]}`)
+
+	case method == http.MethodPut && path == "/line/qna/selected/":
+
+	case method == http.MethodGet && len(parts) == 3 && parts[0] == "line" && parts[1] == "subscriber":
+		user := s.data.User
+		if userID, err := uuid.Parse(parts[2]); err == nil {
+			user.UserID = userID
+		}
+		return toJson(user)
+
+	case method == http.MethodGet && len(parts) == 3 && parts[0] == "line" && parts[1] == "specialist":
+		for _, v := range s.data.Specialists {
+			if v.UserID.String() == parts[2] {
+				return toJson(v)
+			}
+		}
+		return http.StatusNotFound, nil
+
+	case method == http.MethodGet && len(parts) == 4 && parts[1] == "specialists" && parts[3] == "available":
+		return toJson(s.data.AvailableSpecialists)
+
+	case method == http.MethodGet && path == "/line/specialists/":
+		return toJson(s.data.Specialists)
+
+	case method == http.MethodGet && path == "/line/subscriptions/":
+		return toJson(response.Subscriptions{{UserID: s.data.User.UserID}})
+
+	case method == http.MethodGet && len(parts) == 3 && parts[0] == "line" && parts[1] == "file":
+		fileID, err := uuid.Parse(parts[2])
+		if err != nil {
+			return http.StatusBadRequest, nil
+		}
+		s.mu.Lock()
+		content, ok := s.files[fileID]
+		s.mu.Unlock()
+		if !ok {
+			return http.StatusNotFound, nil
+		}
+		return http.StatusOK, content
+
+	case method == http.MethodGet && path == "/ticket/data/":
+		return toJson(s.data.TicketData)
+
+	case method == http.MethodGet && len(parts) == 2 && parts[0] == "ticket":
+		ticketID, err := uuid.Parse(parts[1])
+		if err != nil {
+			return http.StatusBadRequest, nil
+		}
+		s.mu.Lock()
+		ticket, ok := s.tickets[ticketID]
+		s.mu.Unlock()
+		if !ok {
+			return http.StatusNotFound, nil
+		}
+		return toJson(ticket)
+
+	default:
+		s.record(Message{Action: fmt.Sprint("имитация не поддерживает запрос ", method, " ", path)})
+		return http.StatusNotFound, nil
+	}
+
+	return http.StatusOK, []byte("{}")
+}
+
+// достать описание файла из multipart запроса
+func decodeFileMeta(contentType string, body []byte, v any) error {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return err
+		}
+		if part.FormName() == "meta" {
+			return json.NewDecoder(part).Decode(v)
+		}
+	}
+}
+
+// кнопки клавиатуры одним списком
+func flatKeyboard(keyboard *[][]requests.KeyboardKey) (buttons []requests.KeyboardKey) {
+	if keyboard == nil {
+		return
+	}
+	for _, row := range *keyboard {
+		buttons = append(buttons, row...)
+	}
+	return
+}
@@ -0,0 +1,347 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"connect-text-bot/internal/connect/messages"
+	"connect-text-bot/internal/connect/requests"
+	"connect-text-bot/internal/connect/response"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// адрес SOAP сервиса учетной системы
+	SoapUri = "/soap/"
+	// отправить событие боту, аналог push уведомления 1С-Коннект
+	PushUri = "/mock/push/"
+	// получить и очистить список действий бота
+	MessagesUri = "/mock/messages/"
+)
+
+type (
+	// Data - данные, которые возвращает имитация 1С-Коннект
+	Data struct {
+		// линия на которой идет диалог
+		LineID uuid.UUID `yaml:"line_id"`
+		// данные пользователя, user_id подставляется из запроса
+		User response.User `yaml:"user"`
+		// специалисты линии
+		Specialists response.Users `yaml:"specialists"`
+		// id свободных специалистов
+		AvailableSpecialists []uuid.UUID `yaml:"available_specialists"`
+		// данные для заявок
+		TicketData []response.GetTicketDataResponse `yaml:"ticket_data"`
+		// заявки Service Desk, заказчик - initiator.user_id, если не указан то пользователь диалога
+		Tickets []response.Ticket `yaml:"tickets"`
+	}
+
+	// Message - действие бота, полученное имитацией 1С-Коннект
+	Message struct {
+		LineID uuid.UUID `json:"line_id"`
+		UserID uuid.UUID `json:"user_id"`
+		// текст сообщения
+		Text string `json:"text,omitempty"`
+		// имя отправленного файла
+		File string `json:"file,omitempty"`
+		// кнопки клавиатуры
+		Keyboard []requests.KeyboardKey `json:"keyboard,omitempty"`
+		// служебное действие: закрытие обращения, перевод на специалиста и т.п.
+		Action string `json:"action,omitempty"`
+	}
+
+	// Server - имитация API 1С-Коннект и SOAP сервиса учетной системы, все данные хранятся в памяти
+	Server struct {
+		data Data
+
+		mu       sync.Mutex
+		messages []Message
+		hooks    map[uuid.UUID]string
+		tickets  map[uuid.UUID]response.Ticket
+		// файлы, отправленные пользователем
+		files map[uuid.UUID][]byte
+
+		cl  *http.Client
+		srv *http.Server
+		url string
+	}
+)
+
+func New(data Data) *Server {
+	tickets := make(map[uuid.UUID]response.Ticket)
+	for _, t := range data.Tickets {
+		if t.ID == uuid.Nil {
+			t.ID = uuid.New()
+		}
+		if t.Initiator.UserID == uuid.Nil {
+			t.Initiator.UserID = data.User.UserID
+		}
+		tickets[t.ID] = t
+	}
+
+	return &Server{
+		data:    data,
+		hooks:   make(map[uuid.UUID]string),
+		tickets: tickets,
+		files:   make(map[uuid.UUID][]byte),
+		cl:      &http.Client{},
+	}
+}
+
+// Start - запустить http сервер на указанном адресе, например 127.0.0.1:0
+func (s *Server) Start(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.srv = &http.Server{Handler: s}
+	s.url = "http://" + l.Addr().String()
+	go func() {
+		_ = s.srv.Serve(l)
+	}()
+	return nil
+}
+
+// URL - адрес запущенного сервера, используется в connect_server.addr и us_server.addr (с суффиксом SoapUri)
+func (s *Server) URL() string {
+	return s.url
+}
+
+func (s *Server) Close() {
+	if s.srv != nil {
+		_ = s.srv.Close()
+	}
+}
+
+// Transport - обращаться к имитации без сети, в том же процессе
+func (s *Server) Transport() http.RoundTripper {
+	return roundTripper{s}
+}
+
+// Messages - действия бота по порядку
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// TakeMessages - забрать действия бота и очистить список
+func (s *Server) TakeMessages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.messages
+	s.messages = nil
+	return messages
+}
+
+// Push - отправить событие боту на адрес, установленный для линии через /v1/hook/
+func (s *Server) Push(ctx context.Context, msg messages.Message) error {
+	s.mu.Lock()
+	hookUrl, ok := s.hooks[msg.LineID]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("для линии %s не установлен hook", msg.LineID)
+	}
+
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookUrl, bytes.NewReader(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("hook %s вернул код %d", hookUrl, resp.StatusCode)
+	}
+	return nil
+}
+
+// AddFile - сохранить файл пользователя, бот получит его по id через API
+func (s *Server) AddFile(content []byte) uuid.UUID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := uuid.New()
+	s.files[id] = content
+	return id
+}
+
+func (s *Server) record(m Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, m)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var (
+		code    int
+		content []byte
+	)
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, SoapUri):
+		code, content = s.handleSoap(r.Header.Get("SOAPAction"), r.Header.Get("Content-Type"), body)
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+
+	case r.URL.Path == PushUri && r.Method == http.MethodPost:
+		code, content = s.handlePush(r.Context(), body)
+
+	case r.URL.Path == MessagesUri && r.Method == http.MethodGet:
+		code, content = toJson(s.TakeMessages())
+
+	case strings.HasPrefix(r.URL.Path, "/v1/"):
+		code, content = s.handleApi(r.Method, strings.TrimPrefix(r.URL.Path, "/v1"), r.Header.Get("Content-Type"), body)
+		w.Header().Set("Content-Type", "application/json")
+
+	default:
+		code = http.StatusNotFound
+	}
+
+	w.WriteHeader(code)
+	_, _ = w.Write(content)
+}
+
+// событие для бота, недостающие поля заполняются сами
+func (s *Server) handlePush(ctx context.Context, body []byte) (int, []byte) {
+	var msg messages.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return http.StatusBadRequest, []byte(err.Error())
+	}
+
+	if msg.LineID == uuid.Nil {
+		msg.LineID = s.defaultLine()
+	}
+	if msg.MessageID == uuid.Nil {
+		msg.MessageID = uuid.New()
+	}
+	if msg.MessageTime == "" {
+		msg.MessageTime = time.Now().Format(time.RFC3339)
+	}
+	if msg.MessageType == 0 {
+		msg.MessageType = messages.MESSAGE_TEXT
+	}
+	if msg.MessageAuthor == nil && (msg.MessageType == messages.MESSAGE_TEXT || msg.MessageType == messages.MESSAGE_FILE) {
+		msg.MessageAuthor = &msg.UserID
+	}
+	// для файла без id сохраняем заглушку с именем файла
+	if msg.MessageType == messages.MESSAGE_FILE && msg.Data.FileID == uuid.Nil {
+		if msg.Data.FileName == "" {
+			msg.Data.FileName = msg.Text
+		}
+		msg.Data.FileID = s.AddFile([]byte(msg.Data.FileName))
+		if msg.Data.FileSize == 0 {
+			msg.Data.FileSize = int64(len(msg.Data.FileName))
+		}
+	}
+
+	if err := s.Push(ctx, msg); err != nil {
+		return http.StatusBadGateway, []byte(err.Error())
+	}
+	return http.StatusOK, nil
+}
+
+// линия из данных имитации или единственная линия, для которой установлен hook
+func (s *Server) defaultLine() uuid.UUID {
+	if s.data.LineID != uuid.Nil {
+		return s.data.LineID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.hooks) == 1 {
+		for lineID := range s.hooks {
+			return lineID
+		}
+	}
+	return uuid.Nil
+}
+
+func toJson(v any) (int, []byte) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return http.StatusInternalServerError, nil
+	}
+	return http.StatusOK, content
+}
+
+// вызывает обработчик имитации напрямую, без сети
+type roundTripper struct {
+	s *Server
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+
+	rec := &responseRecorder{header: make(http.Header)}
+	rt.s.ServeHTTP(rec, req)
+
+	code := rec.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.header,
+		Body:          io.NopCloser(&rec.body),
+		ContentLength: int64(rec.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// ответ обработчика в памяти
+type responseRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
@@ -0,0 +1,281 @@
+package mock
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"connect-text-bot/internal/connect/response"
+	"connect-text-bot/internal/us"
+
+	"github.com/google/uuid"
+	"github.com/hooklift/gowsdl/soap"
+)
+
+// имитация SOAP сервиса учетной системы: регистрация заявок, список заявок, сообщения и файлы заявки
+func (s *Server) handleSoap(action, contentType string, body []byte) (int, []byte) {
+	var content any
+
+	// MTOM: xml в первой части, файлы в остальных
+	body, attachments, err := splitMtom(contentType, body)
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+
+	switch {
+	case strings.HasSuffix(strings.Trim(action, `"`), ":ServiceRequestAdd"):
+		var envelope struct {
+			Body struct {
+				Request us.ServiceRequestAdd `xml:"ServiceRequestAdd"`
+			} `xml:"Body"`
+		}
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			return http.StatusBadRequest, nil
+		}
+
+		var (
+			ticket = response.Ticket{ID: uuid.New(), CreatedAt: time.Now(), Status: response.TicketStatus{Name: "Новая", Type: "NEW"}}
+			msg    = Message{Action: "зарегистрирована заявка: "}
+		)
+		if envelope.Body.Request.Params != nil {
+			for _, v := range envelope.Body.Request.Params.Property {
+				switch v.Name {
+				case "Summary":
+					ticket.Summary = v.Value.Text
+				case "Description":
+					ticket.Description = v.Value.Text
+				case "ServiceLineKindID":
+					msg.LineID, _ = uuid.Parse(v.Value.Text)
+				case "UserID":
+					msg.UserID, _ = uuid.Parse(v.Value.Text)
+					ticket.Initiator.UserID = msg.UserID
+				case "Priority":
+					ticket.Priority = v.Value.Text
+				case "Deadline":
+					ticket.Deadline = v.Value.Text
+				case "FIELD1", "FIELD2", "FIELD3", "FIELD4":
+					ticket.Fields = append(ticket.Fields, response.TicketAdditionalFieldValue{ID: v.Name, Value: v.Value.Text})
+				}
+			}
+		}
+
+		ticket.Line.ID = msg.LineID
+
+		s.mu.Lock()
+		ticket.Number = fmt.Sprint(len(s.tickets) + 1)
+		s.tickets[ticket.ID] = ticket
+		s.mu.Unlock()
+
+		msg.Action += ticket.Summary
+		// необязательные поля выводим только если они переданы
+		var extra []string
+		if ticket.Priority != "" {
+			extra = append(extra, "приоритет "+ticket.Priority)
+		}
+		if ticket.Deadline != "" {
+			extra = append(extra, "срок "+ticket.Deadline)
+		}
+		for _, f := range ticket.Fields {
+			extra = append(extra, f.ID+"="+f.Value)
+		}
+		if len(extra) != 0 {
+			msg.Action += " (" + strings.Join(extra, ", ") + ")"
+		}
+		s.record(msg)
+
+		content = &us.ServiceRequestAddResponse{
+			Return_: &us.ParamsStructure{
+				Property: []us.ParamsPropertyStructure{
+					{Name: us.ResultCode, Value: us.PropertyValueStructure{Text: us.SUCCESS}},
+					{Name: us.ResultData, Value: us.PropertyValueStructure{
+						Property: []us.PropertyValuePropertyStructure{
+							{Name: "ServiceRequestID", Value: us.PropertyValuePropertyValueStructure{Text: ticket.ID.String()}},
+						},
+					}},
+				},
+			},
+		}
+
+	case strings.HasSuffix(strings.Trim(action, `"`), ":ServiceRequestRead"):
+		var envelope struct {
+			Body struct {
+				Request us.ServiceRequestRead `xml:"ServiceRequestRead"`
+			} `xml:"Body"`
+		}
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			return http.StatusBadRequest, nil
+		}
+
+		var userID uuid.UUID
+		if envelope.Body.Request.Params != nil {
+			for _, v := range envelope.Body.Request.Params.Property {
+				if v.Name == "UserID" {
+					userID, _ = uuid.Parse(v.Value.Text)
+				}
+			}
+		}
+
+		content = &us.ServiceRequestReadResponse{
+			Return_: &us.ParamsTable{
+				Property: []us.ParamsPropertyTable{
+					{Name: us.ResultCode, Value: us.PropertyValueTable{Text: us.SUCCESS}},
+					{Name: us.ResultData, Value: s.ticketsTable(userID)},
+				},
+			},
+		}
+
+	case strings.HasSuffix(strings.Trim(action, `"`), ":ServiceRequestSendTextMessage"):
+		var envelope struct {
+			Body struct {
+				Request us.ServiceRequestSendTextMessage `xml:"ServiceRequestSendTextMessage"`
+			} `xml:"Body"`
+		}
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			return http.StatusBadRequest, nil
+		}
+		r := envelope.Body.Request
+
+		number, ok := s.ticketNumber(r.ServiceRequestID)
+		if !ok {
+			content = soapResult(us.ResultCode, "ServiceRequestNotFound")
+			break
+		}
+		s.record(Message{Action: fmt.Sprintf("сообщение в заявке №%s: %s", number, r.Message)})
+		content = &us.ServiceRequestSendTextMessageResponse{Return_: soapResult(us.ResultCode, us.SUCCESS)}
+
+	case strings.HasSuffix(strings.Trim(action, `"`), ":ServiceRequestAttachFile"):
+		// Binary не читается без MTOM, поэтому разбираем ссылку на файл сами
+		var envelope struct {
+			Body struct {
+				Request struct {
+					ServiceRequestID string `xml:"ServiceRequestID"`
+					Name             string `xml:"Name"`
+					Data             struct {
+						Include struct {
+							Href string `xml:"href,attr"`
+						} `xml:"http://www.w3.org/2004/08/xop/include Include"`
+					} `xml:"Data"`
+				} `xml:"ServiceRequestAttachFile"`
+			} `xml:"Body"`
+		}
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			return http.StatusBadRequest, nil
+		}
+		r := envelope.Body.Request
+
+		data, ok := attachments[strings.TrimPrefix(r.Data.Include.Href, "cid:")]
+		if !ok {
+			return http.StatusBadRequest, nil
+		}
+		number, ok := s.ticketNumber(r.ServiceRequestID)
+		if !ok {
+			content = soapResult(us.ResultCode, "ServiceRequestNotFound")
+			break
+		}
+		s.record(Message{Action: fmt.Sprintf("файл в заявке №%s: %s (%d байт)", number, r.Name, len(data))})
+		content = &us.ServiceRequestAttachFileResponse{Return_: soapResult(us.ResultCode, us.SUCCESS)}
+
+	default:
+		s.record(Message{Action: "имитация не поддерживает SOAP запрос " + action})
+		content = &soap.SOAPFault{Code: "soap:Server", String: "not supported by mock"}
+	}
+
+	envelope, err := xml.Marshal(soap.SOAPEnvelope{
+		XmlNS: "http://schemas.xmlsoap.org/soap/envelope/",
+		Body:  soap.SOAPBody{Content: content},
+	})
+	if err != nil {
+		return http.StatusInternalServerError, nil
+	}
+	return http.StatusOK, envelope
+}
+
+// id заявок пользователя в виде таблицы значений, по порядку номеров
+func (s *Server) ticketsTable(userID uuid.UUID) us.PropertyValueTable {
+	table := us.PropertyValueTable{Type: "ValueTable"}
+	table.Column = append(table.Column, us.PropertyValueTableColumn{Name: "ServiceRequestID", ValueType: us.PropertyValueTableColumnValueType{Type: us.XsString}})
+
+	s.mu.Lock()
+	tickets := make([]response.Ticket, 0, len(s.tickets))
+	for _, t := range s.tickets {
+		if t.Initiator.UserID == userID {
+			tickets = append(tickets, t)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(tickets, func(a, b response.Ticket) int {
+		return cmp.Or(cmp.Compare(len(a.Number), len(b.Number)), cmp.Compare(a.Number, b.Number))
+	})
+
+	for _, t := range tickets {
+		row := us.PropertyValueTableRow{}
+		row.Value = append(row.Value, us.PropertyValueTableRowValue{Type: us.XsString, Text: t.ID.String()})
+		table.Row = append(table.Row, row)
+	}
+	return table
+}
+
+// номер заявки по id
+func (s *Server) ticketNumber(id string) (string, bool) {
+	ticketID, err := uuid.Parse(id)
+	if err != nil {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tickets[ticketID]
+	return t.Number, ok
+}
+
+// ответ с кодом результата без данных
+func soapResult(name, code string) *us.ParamsStructure {
+	return &us.ParamsStructure{
+		Property: []us.ParamsPropertyStructure{
+			{Name: name, Value: us.PropertyValueStructure{Text: code}},
+		},
+	}
+}
+
+// разделить MTOM запрос на xml и файлы по Content-ID, обычный запрос возвращается как есть
+func splitMtom(contentType string, body []byte) ([]byte, map[string][]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/related" {
+		return body, nil, nil
+	}
+
+	var (
+		root        []byte
+		attachments = make(map[string][]byte)
+	)
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return root, attachments, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		if root == nil {
+			root = content
+			continue
+		}
+		attachments[strings.Trim(part.Header.Get("Content-ID"), "<>")] = content
+	}
+}
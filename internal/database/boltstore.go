@@ -0,0 +1,136 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"connect-text-bot/internal/logger"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var stateBucket = []byte("state")
+
+// хранилище состояний во встроенной файловой БД, переживает перезапуск бота
+type boltStore struct {
+	db *bolt.DB
+
+	lifeWindow time.Duration
+
+	done chan struct{}
+}
+
+func ConnectBoltStore(cnf StateStoreConfig) (StateStore, error) {
+	if err := os.MkdirAll(filepath.Dir(cnf.Path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(cnf.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s := &boltStore{
+		db:         db,
+		lifeWindow: cnf.LifeWindow,
+		done:       make(chan struct{}),
+	}
+	go s.cleanup(cnf.CleanWindow)
+
+	return s, nil
+}
+
+// первые 8 байт записи - время истечения состояния
+func (s *boltStore) encode(data []byte) []byte {
+	entry := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(entry, uint64(time.Now().Add(s.lifeWindow).UnixNano()))
+	copy(entry[8:], data)
+	return entry
+}
+
+func isExpired(entry []byte, now time.Time) bool {
+	return len(entry) < 8 || int64(binary.BigEndian.Uint64(entry)) < now.UnixNano()
+}
+
+func (s *boltStore) Get(key string) (data []byte, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		entry := tx.Bucket(stateBucket).Get([]byte(key))
+		if entry == nil || isExpired(entry, time.Now()) {
+			return ErrEntryNotFound
+		}
+		// данные валидны только внутри транзакции
+		data = append([]byte(nil), entry[8:]...)
+		return nil
+	})
+	return
+}
+
+func (s *boltStore) Set(key string, data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Put([]byte(key), s.encode(data))
+	})
+}
+
+func (s *boltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Delete([]byte(key))
+	})
+}
+
+func (s *boltStore) Keys() (keys []string, err error) {
+	now := time.Now()
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).ForEach(func(k, v []byte) error {
+			if !isExpired(v, now) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (s *boltStore) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+// периодически удаляем устаревшие состояния
+func (s *boltStore) cleanup(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			err := s.db.Update(func(tx *bolt.Tx) error {
+				c := tx.Bucket(stateBucket).Cursor()
+				for k, v := c.First(); k != nil; k, v = c.Next() {
+					if isExpired(v, now) {
+						if err := c.Delete(); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, bolt.ErrDatabaseNotOpen) {
+				logger.Warning("Error while cleanup state store", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// префикс ключей в хранилище состояний
+const dedupPrefix = "dedup:"
+
+type (
+	// DedupConfig - настройки защиты от повторной обработки
+	DedupConfig struct {
+		// сколько помнить обработанные события, по умолчанию 10m, не больше state_store.life_window
+		Retention time.Duration `yaml:"retention"`
+	}
+
+	// Dedup - помнит обработанные события и действия, чтобы не выполнять их повторно
+	Dedup struct {
+		store     StateStore
+		retention time.Duration
+
+		mu sync.Mutex
+	}
+)
+
+func NewDedup(store StateStore, cnf DedupConfig) *Dedup {
+	if cnf.Retention <= 0 {
+		cnf.Retention = 10 * time.Minute
+	}
+	return &Dedup{
+		store:     store,
+		retention: cnf.Retention,
+	}
+}
+
+// Once - отметить ключ обработанным, false если он уже был отмечен в пределах retention
+func (d *Dedup) Once(key string) (bool, error) {
+	key = dedupPrefix + key
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, err := d.store.Get(key)
+	if err != nil && !errors.Is(err, ErrEntryNotFound) {
+		return false, err
+	}
+	if err == nil && len(data) == 8 {
+		seen := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+		if now.Sub(seen) < d.retention {
+			return false, nil
+		}
+	}
+
+	data = make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(now.UnixNano()))
+	return true, d.store.Set(key, data)
+}
+
+// Forget - снять отметку, например если действие не удалось и его можно повторить
+func (d *Dedup) Forget(key string) error {
+	return d.store.Delete(dedupPrefix + key)
+}
+
+func InjectDedup(key string, dedup *Dedup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(key, dedup)
+	}
+}
@@ -1,24 +1,65 @@
 package database
 
 import (
-	"time"
-
-	"connect-text-bot/internal/logger"
+	"errors"
 
 	"github.com/allegro/bigcache/v3"
-	"github.com/gin-gonic/gin"
 )
 
-func ConnectInMemoryCache() *bigcache.BigCache {
-	cache, err := bigcache.NewBigCache(bigcache.DefaultConfig(2 * time.Hour))
+// хранилище состояний в памяти процесса
+type memoryStore struct {
+	cache *bigcache.BigCache
+}
+
+func ConnectInMemoryCache(cnf StateStoreConfig) (StateStore, error) {
+	bcCnf := bigcache.DefaultConfig(cnf.LifeWindow)
+	bcCnf.CleanWindow = cnf.CleanWindow
+	if cnf.Shards > 0 {
+		bcCnf.Shards = cnf.Shards
+	}
+	bcCnf.HardMaxCacheSize = cnf.HardMaxCacheSize
+
+	cache, err := bigcache.NewBigCache(bcCnf)
 	if err != nil {
-		logger.Crit(err)
+		return nil, err
+	}
+	return &memoryStore{cache: cache}, nil
+}
+
+func (s *memoryStore) Get(key string) ([]byte, error) {
+	data, err := s.cache.Get(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil, ErrEntryNotFound
 	}
-	return cache
+	return data, err
 }
 
-func InjectInMemoryCache(key string, cache *bigcache.BigCache) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Set(key, cache)
+func (s *memoryStore) Set(key string, data []byte) error {
+	return s.cache.Set(key, data)
+}
+
+func (s *memoryStore) Delete(key string) error {
+	err := s.cache.Delete(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *memoryStore) Keys() ([]string, error) {
+	keys := make([]string, 0, s.cache.Len())
+
+	it := s.cache.Iterator()
+	for it.SetNext() {
+		entry, err := it.Value()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, entry.Key())
 	}
+	return keys, nil
+}
+
+func (s *memoryStore) Close() error {
+	return s.cache.Close()
 }
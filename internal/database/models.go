@@ -1,6 +1,11 @@
 package database
 
-import "github.com/google/uuid"
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 const (
 	GREETINGS = "greetings"
@@ -12,6 +17,10 @@ const (
 	// регистрация заявки
 	CREATE_TICKET            = "create_ticket"
 	CREATE_TICKET_PREV_STAGE = "create_ticket_prev_stage"
+	// список заявок пользователя
+	MY_TICKETS = "my_tickets"
+	// сообщения и файлы в выбранную заявку
+	TICKET_COMMENT = "ticket_comment"
 )
 
 const (
@@ -19,21 +28,77 @@ const (
 	VAR_FOR_SAVE = "VAR_FOR_SAVE"
 )
 
+// приоритеты заявки Service Desk
+const (
+	TICKET_PRIORITY_LOW      = "LOW"
+	TICKET_PRIORITY_STANDARD = "STANDARD"
+	TICKET_PRIORITY_HIGH     = "HIGH"
+)
+
+// префикс шага заполнения дополнительного поля заявки, после него идет id поля (FIELD1...FIELD4)
+const TICKET_FIELD_PREFIX = "field:"
+
+// формат вывода срока заявки
+const TICKET_DEADLINE_LAYOUT = "02.01.2006 15:04"
+
+// названия приоритетов в порядке вывода пользователю
+var TicketPriorities = []struct {
+	ID   string
+	Name string
+}{
+	{TICKET_PRIORITY_LOW, "Низкий"},
+	{TICKET_PRIORITY_STANDARD, "Стандартный"},
+	{TICKET_PRIORITY_HIGH, "Высокий"},
+}
+
 // данные для формирования заявки
 type (
 	Ticket struct {
+		// черновик заявки, создается при нажатии на ticket_button
+		DraftID     uuid.UUID
 		ChannelID   uuid.UUID
 		Theme       string
 		Description string
 		Executor    TicketPart
 		Service     TicketPart
 		ServiceType TicketPart
+		// дополнительные поля выбранного типа заявки
+		Fields []TicketField
+		// приоритет: LOW, STANDARD, HIGH, пустой - приоритет по умолчанию
+		Priority string
+		// срок, нулевое значение - срок не задан
+		Deadline time.Time
+		// файлы пользователя, прикрепляются к заявке после регистрации
+		Files []File
 	}
 
 	TicketPart struct {
 		ID   uuid.UUID
 		Name *string
 	}
+
+	// вариант ответа save_to_var: текст кнопки и сохраняемое значение
+	Option struct {
+		Text  string `json:"text"`
+		Value string `json:"value"`
+	}
+
+	// файл, отправленный пользователем, содержимое хранится в 1С-Коннект
+	File struct {
+		ID   uuid.UUID `json:"id"`
+		Name string    `json:"name"`
+		// размер в байтах, 0 - неизвестен
+		Size int64 `json:"size,omitempty"`
+	}
+
+	// дополнительное поле заявки
+	TicketField struct {
+		// id поля: FIELD1...FIELD4
+		ID string
+		// название поля в Service Desk
+		Name  string
+		Value string
+	}
 )
 
 func (_ *Ticket) GetChannel() string     { return "channel" }
@@ -43,3 +108,53 @@ func (_ *Ticket) GetExecutor() string    { return "executor" }
 func (_ *Ticket) GetService() string     { return "service" }
 func (_ *Ticket) GetServiceType() string { return "type" }
 func (_ *Ticket) GetFinal() string       { return "FINAL" }
+func (_ *Ticket) GetPriority() string    { return "priority" }
+func (_ *Ticket) GetDeadline() string    { return "deadline" }
+
+func (_ *Ticket) GetField(id string) string { return TICKET_FIELD_PREFIX + id }
+
+// получить дополнительное поле по имени шага field:FIELD1
+func (t *Ticket) FieldByStage(stage string) (*TicketField, bool) {
+	id, ok := strings.CutPrefix(stage, TICKET_FIELD_PREFIX)
+	if !ok {
+		return nil, false
+	}
+	for i := range t.Fields {
+		if t.Fields[i].ID == id {
+			return &t.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// название приоритета для вывода в шаблонах
+func (t Ticket) PriorityName() string {
+	return TicketPriorityName(t.Priority)
+}
+
+// срок в формате 02.01.2006 15:04 для вывода в шаблонах, пустая строка если срок не задан
+func (t Ticket) DeadlineText() string {
+	if t.Deadline.IsZero() {
+		return ""
+	}
+	return t.Deadline.Format(TICKET_DEADLINE_LAYOUT)
+}
+
+func TicketPriorityName(id string) string {
+	for _, p := range TicketPriorities {
+		if p.ID == id {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// найти приоритет по названию или id, пустая строка если не найден
+func TicketPriorityID(text string) string {
+	for _, p := range TicketPriorities {
+		if strings.EqualFold(p.Name, text) || p.ID == text {
+			return p.ID
+		}
+	}
+	return ""
+}
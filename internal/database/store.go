@@ -0,0 +1,102 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"connect-text-bot/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// хранение состояний в памяти процесса
+	STORE_MEMORY = "memory"
+	// хранение состояний во встроенной файловой БД
+	STORE_BOLT = "bolt"
+)
+
+// запись отсутствует в хранилище
+var ErrEntryNotFound = errors.New("entry not found")
+
+type (
+	// StateStore - хранилище состояний чатов пользователей
+	StateStore interface {
+		// получить данные по ключу
+		Get(key string) ([]byte, error)
+		// записать данные по ключу
+		Set(key string, data []byte) error
+		// удалить данные по ключу
+		Delete(key string) error
+		// получить список всех ключей
+		Keys() ([]string, error)
+		// освободить ресурсы хранилища
+		Close() error
+	}
+
+	// настройки хранилища состояний
+	StateStoreConfig struct {
+		// тип хранилища: memory | bolt
+		Type string `yaml:"type"`
+		// время жизни состояния пользователя
+		LifeWindow time.Duration `yaml:"life_window"`
+		// период очистки устаревших состояний
+		CleanWindow time.Duration `yaml:"clean_window"`
+
+		// путь к файлу БД (для bolt)
+		Path string `yaml:"path"`
+
+		// количество шардов, должно быть степенью двойки (для memory)
+		Shards int `yaml:"shards"`
+		// ограничение размера кеша в МБ, 0 - без ограничений (для memory)
+		HardMaxCacheSize int `yaml:"hard_max_cache_size"`
+	}
+)
+
+// применить настройки "по умолчанию" для хранилища
+func (cnf *StateStoreConfig) SetDefault() {
+	if cnf.Type == "" {
+		cnf.Type = STORE_MEMORY
+	}
+	if cnf.LifeWindow <= 0 {
+		cnf.LifeWindow = 2 * time.Hour
+	}
+	if cnf.CleanWindow <= 0 {
+		cnf.CleanWindow = time.Minute
+	}
+	if cnf.Path == "" {
+		cnf.Path = "./state.db"
+	}
+}
+
+// ConnectStateStore - создать хранилище состояний согласно настройкам
+func ConnectStateStore(cnf StateStoreConfig) StateStore {
+	cnf.SetDefault()
+
+	var (
+		store StateStore
+		err   error
+	)
+
+	switch cnf.Type {
+	case STORE_MEMORY:
+		store, err = ConnectInMemoryCache(cnf)
+	case STORE_BOLT:
+		store, err = ConnectBoltStore(cnf)
+	default:
+		err = errors.New("неизвестный тип хранилища состояний: " + cnf.Type)
+	}
+	if err != nil {
+		logger.Crit(err)
+	}
+
+	logger.Info("State store:", cnf.Type)
+	return store
+}
+
+// InjectStateStore - Adds a state store to the Gin context
+func InjectStateStore(key string, store StateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(key, store)
+	}
+}
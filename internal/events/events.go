@@ -0,0 +1,114 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"connect-text-bot/internal/logger"
+
+	"github.com/google/uuid"
+)
+
+// виды событий
+const (
+	// переход пользователя между состояниями после обработки сообщения
+	TRANSITION = "transition"
+	// нажатие кнопки
+	BUTTON = "button"
+	// команда, которую бот не понял
+	UNKNOWN_COMMAND = "unknown_command"
+	// найдена подсказка в базе знаний
+	QNA_HIT = "qna_hit"
+	// подсказка в базе знаний не найдена
+	QNA_MISS = "qna_miss"
+	// результат выполнения exec_button
+	EXEC = "exec"
+	// регистрация заявки
+	TICKET = "ticket"
+)
+
+type (
+	// Config - настройки журнала событий
+	Config struct {
+		// путь к файлу журнала, если не указан то журнал не ведется
+		Path string `yaml:"path"`
+		// размер файла в МБ, после которого начинается новый файл, по умолчанию 10
+		MaxSize int `yaml:"max_size"`
+		// сколько предыдущих файлов хранить, по умолчанию 5
+		MaxFiles int `yaml:"max_files"`
+	}
+
+	// Event - запись журнала событий
+	Event struct {
+		Time   time.Time `json:"time"`
+		Type   string    `json:"type"`
+		LineID uuid.UUID `json:"line_id"`
+		UserID uuid.UUID `json:"user_id"`
+		// меню до и после события
+		From string `json:"from,omitempty"`
+		To   string `json:"to,omitempty"`
+		// нажатая кнопка
+		ButtonID string `json:"button_id,omitempty"`
+		// текст пользователя, команда или id заявки
+		Text string `json:"text,omitempty"`
+		// время обработки в миллисекундах
+		Latency int64  `json:"latency_ms,omitempty"`
+		Error   string `json:"error,omitempty"`
+	}
+)
+
+var (
+	mu     sync.Mutex
+	writer *rotateWriter
+)
+
+// Init - начать запись журнала событий, без пути журнал не ведется
+func Init(cnf Config) error {
+	if cnf.Path == "" {
+		return nil
+	}
+
+	w, err := newRotateWriter(cnf)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	writer = w
+	return nil
+}
+
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if writer != nil {
+		_ = writer.Close()
+		writer = nil
+	}
+}
+
+// Log - записать событие в журнал
+func Log(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if writer == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.Warning("Ошибка записи события", err)
+		return
+	}
+	if _, err := writer.Write(append(data, '\n')); err != nil {
+		logger.Warning("Ошибка записи события", err)
+	}
+}
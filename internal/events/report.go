@@ -0,0 +1,161 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// Report - сводка по журналу событий
+	Report struct {
+		// учитывать только события линии
+		LineID uuid.UUID
+		// учитывать только события после указанного момента
+		Since time.Time
+
+		Events  int
+		Errors  int
+		QnaHit  int
+		QnaMiss int
+		Tickets int
+
+		visits  map[string]int
+		users   map[string]map[uuid.UUID]struct{}
+		buttons map[string]int
+		unknown map[string]int
+		// последнее меню каждого пользователя
+		last map[uuid.UUID]string
+	}
+
+	// Count - строка сводки
+	Count struct {
+		Name  string
+		Count int
+		Users int
+	}
+)
+
+func NewReport() *Report {
+	return &Report{
+		visits:  make(map[string]int),
+		users:   make(map[string]map[uuid.UUID]struct{}),
+		buttons: make(map[string]int),
+		unknown: make(map[string]int),
+		last:    make(map[uuid.UUID]string),
+	}
+}
+
+// AddFrom - добавить события из журнала, строки которые не удалось разобрать пропускаются
+func (r *Report) AddFrom(rd io.Reader) error {
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		r.Add(e)
+	}
+	return sc.Err()
+}
+
+// Add - учесть событие в сводке
+func (r *Report) Add(e Event) {
+	if r.LineID != uuid.Nil && e.LineID != r.LineID {
+		return
+	}
+	if !r.Since.IsZero() && e.Time.Before(r.Since) {
+		return
+	}
+
+	r.Events++
+	if e.Error != "" {
+		r.Errors++
+	}
+
+	switch e.Type {
+	case TRANSITION:
+		if e.To == "" {
+			return
+		}
+		if e.To != e.From {
+			r.visits[e.To]++
+			if r.users[e.To] == nil {
+				r.users[e.To] = make(map[uuid.UUID]struct{})
+			}
+			r.users[e.To][e.UserID] = struct{}{}
+		}
+		r.last[e.UserID] = e.To
+	case BUTTON:
+		r.buttons[e.From+": "+e.ButtonID]++
+	case UNKNOWN_COMMAND:
+		r.unknown[strings.ToLower(strings.TrimSpace(e.Text))]++
+	case QNA_HIT:
+		r.QnaHit++
+	case QNA_MISS:
+		r.QnaMiss++
+	case TICKET:
+		if e.Error == "" {
+			r.Tickets++
+		}
+	}
+}
+
+// Funnel - сколько раз и сколько пользователей переходили в каждое меню
+func (r *Report) Funnel() []Count {
+	result := make([]Count, 0, len(r.visits))
+	for name, count := range r.visits {
+		result = append(result, Count{Name: name, Count: count, Users: len(r.users[name])})
+	}
+	return sortCounts(result)
+}
+
+// DropOffs - в каком меню пользователи остановились, состояния skip не учитываются
+func (r *Report) DropOffs(skip ...string) []Count {
+	counts := make(map[string]int)
+	for _, state := range r.last {
+		counts[state]++
+	}
+	for _, s := range skip {
+		delete(counts, s)
+	}
+	return sortCounts(toCounts(counts))
+}
+
+// Buttons - нажатия кнопок в виде "меню: id кнопки"
+func (r *Report) Buttons() []Count {
+	return sortCounts(toCounts(r.buttons))
+}
+
+// TopUnknown - самые частые непонятые команды
+func (r *Report) TopUnknown(n int) []Count {
+	result := sortCounts(toCounts(r.unknown))
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+func toCounts(m map[string]int) []Count {
+	result := make([]Count, 0, len(m))
+	for name, count := range m {
+		result = append(result, Count{Name: name, Count: count})
+	}
+	return result
+}
+
+func sortCounts(c []Count) []Count {
+	sort.Slice(c, func(i, j int) bool {
+		if c[i].Count != c[j].Count {
+			return c[i].Count > c[j].Count
+		}
+		return c[i].Name < c[j].Name
+	})
+	return c
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// пишет в файл, при превышении размера переименовывает его в <path>.1, <path>.2 и т.д.
+type rotateWriter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	f    *os.File
+	size int64
+}
+
+func newRotateWriter(cnf Config) (*rotateWriter, error) {
+	if cnf.MaxSize <= 0 {
+		cnf.MaxSize = 10
+	}
+	if cnf.MaxFiles <= 0 {
+		cnf.MaxFiles = 5
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cnf.Path), 0o755); err != nil {
+		return nil, err
+	}
+
+	w := &rotateWriter{
+		path:     cnf.Path,
+		maxSize:  int64(cnf.MaxSize) * 1024 * 1024,
+		maxFiles: cnf.MaxFiles,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	w.f = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// сдвинуть предыдущие файлы и начать новый
+func (w *rotateWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+
+	_ = os.Remove(RotatedName(w.path, w.maxFiles))
+	for i := w.maxFiles - 1; i >= 1; i-- {
+		_ = os.Rename(RotatedName(w.path, i), RotatedName(w.path, i+1))
+	}
+	if err := os.Rename(w.path, RotatedName(w.path, 1)); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *rotateWriter) Close() error {
+	return w.f.Close()
+}
+
+// RotatedName - имя предыдущего файла журнала с номером n
+func RotatedName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"connect-text-bot/internal/connect/messages"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "connect_bot"
+
+var (
+	eventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_received_total",
+		Help:      "Событий получено от 1С-Коннект по типу сообщения.",
+	}, []string{"message_type"})
+
+	buttonTriggers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "button_triggers_total",
+		Help:      "Нажатий кнопок по меню и id кнопки.",
+	}, []string{"menu", "button"})
+
+	qnaRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "qna_requests_total",
+		Help:      "Запросов к базе знаний: hit - подсказка найдена, miss - не найдена.",
+	}, []string{"result"})
+
+	ticketsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tickets_created_total",
+		Help:      "Регистраций заявок: success - заявка зарегистрирована, error - ошибка регистрации.",
+	}, []string{"result"})
+
+	connectRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connect_api_requests_total",
+		Help:      "Запросов к API 1С-Коннект по методу и http коду ответа, error - ответ не получен.",
+	}, []string{"endpoint", "status"})
+
+	connectDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "connect_api_request_duration_seconds",
+		Help:      "Время запросов к API 1С-Коннект.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	processDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "process_message_duration_seconds",
+		Help:      "Время обработки события ботом по типу сообщения.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"message_type"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		eventsReceived,
+		buttonTriggers,
+		qnaRequests,
+		ticketsCreated,
+		connectRequests,
+		connectDuration,
+		processDuration,
+	)
+}
+
+// Handler - обработчик /metrics в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// EventReceived - получено событие от 1С-Коннект
+func EventReceived(messageType messages.MessageType) {
+	eventsReceived.WithLabelValues(strconv.Itoa(int(messageType))).Inc()
+}
+
+// ButtonTriggered - пользователь нажал кнопку
+func ButtonTriggered(menu, buttonID string) {
+	buttonTriggers.WithLabelValues(menu, buttonID).Inc()
+}
+
+// Qna - результат запроса к базе знаний
+func Qna(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	qnaRequests.WithLabelValues(result).Inc()
+}
+
+// TicketCreated - результат регистрации заявки
+func TicketCreated(err error) {
+	ticketsCreated.WithLabelValues(result(err)).Inc()
+}
+
+// ConnectRequest - выполнен запрос к API 1С-Коннект, status 0 если ответ не получен
+func ConnectRequest(methodUrl string, status int, d time.Duration) {
+	endpoint := endpointLabel(methodUrl)
+
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	connectRequests.WithLabelValues(endpoint, code).Inc()
+	connectDuration.WithLabelValues(endpoint).Observe(d.Seconds())
+}
+
+// ProcessMessage - событие обработано ботом
+func ProcessMessage(messageType messages.MessageType, d time.Duration) {
+	processDuration.WithLabelValues(strconv.Itoa(int(messageType))).Observe(d.Seconds())
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// метод API без id, чтобы не плодить метки: /line/subscriber/<id>/ -> /line/subscriber/:id/
+func endpointLabel(methodUrl string) string {
+	parts := strings.Split(strings.Trim(methodUrl, "/"), "/")
+	for i, p := range parts {
+		if _, err := uuid.Parse(p); err == nil {
+			parts[i] = ":id"
+		}
+	}
+	return "/" + strings.Join(parts, "/") + "/"
+}
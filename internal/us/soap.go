@@ -2,6 +2,9 @@ package us
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 
 	"connect-text-bot/internal/database"
 
@@ -13,20 +16,67 @@ import (
 func CreateTicket(ctx context.Context, soapcl *soap.Client, userID, lineID uuid.UUID, ticket database.Ticket) (content map[string]string, err error) {
 	service := NewPartnerWebAPI2PortType(soapcl)
 
+	properties := []ParamsProperty{
+		formProperty("ServiceRequestChannelID", XsString, ticket.ChannelID.String()),
+		formProperty("ServiceLineKindID", XsString, lineID.String()),
+		formProperty("ServiceKindID", XsString, ticket.Service.ID.String()),
+		formProperty("ServiceRequestTypeID", XsString, ticket.ServiceType.ID.String()),
+		formProperty("UserID", XsString, userID.String()),
+		formProperty("ExecutorID", XsString, ticket.Executor.ID.String()),
+		formProperty("Description", XsString, ticket.Description),
+		formProperty("Summary", XsString, ticket.Theme),
+	}
+
+	// необязательные поля передаем только если они заполнены
+	if ticket.Priority != "" {
+		properties = append(properties, formProperty("Priority", XsString, ticket.Priority))
+	}
+	if !ticket.Deadline.IsZero() {
+		properties = append(properties, formProperty("Deadline", XsDateTime, ticket.Deadline.Format(DateTimeLayout)))
+	}
+	for _, f := range ticket.Fields {
+		if f.Value != "" {
+			properties = append(properties, formProperty(f.ID, XsString, f.Value))
+		}
+	}
+
 	serviceRequestAdd, err := service.ServiceRequestAddContext(
 		ctx,
 		&ServiceRequestAdd{
+			Xs:     "http://www.w3.org/2001/XMLSchema",
+			Params: &Params{Property: properties},
+		},
+	)
+	if err != nil {
+		return
+	}
+
+	r, err := serviceRequestAdd.Return_.GetResult()
+	if err != nil {
+		return
+	}
+
+	content = make(map[string]string)
+	for _, v := range r {
+		content[v.Name] = v.Value.Text
+	}
+
+	return
+}
+
+// ID заявок пользователя на линии. Параметры UserID и ServiceLineKindID и колонка ServiceRequestID
+// называются так же, как в ServiceRequestAdd, остальные данные заявки берутся из API 1С-Коннект
+func ReadTicketIDs(ctx context.Context, soapcl *soap.Client, userID, lineID uuid.UUID) (ids []uuid.UUID, err error) {
+	service := NewPartnerWebAPI2PortType(soapcl)
+
+	serviceRequestRead, err := service.ServiceRequestReadContext(
+		ctx,
+		&ServiceRequestRead{
 			Xs: "http://www.w3.org/2001/XMLSchema",
 			Params: &Params{
 				Property: []ParamsProperty{
-					formProperty("ServiceRequestChannelID", XsString, ticket.ChannelID.String()),
-					formProperty("ServiceLineKindID", XsString, lineID.String()),
-					formProperty("ServiceKindID", XsString, ticket.Service.ID.String()),
-					formProperty("ServiceRequestTypeID", XsString, ticket.ServiceType.ID.String()),
 					formProperty("UserID", XsString, userID.String()),
-					formProperty("ExecutorID", XsString, ticket.Executor.ID.String()),
-					formProperty("Description", XsString, ticket.Description),
-					formProperty("Summary", XsString, ticket.Theme),
+					formProperty("ServiceLineKindID", XsString, lineID.String()),
 				},
 			},
 		},
@@ -34,20 +84,83 @@ func CreateTicket(ctx context.Context, soapcl *soap.Client, userID, lineID uuid.
 	if err != nil {
 		return
 	}
+	if serviceRequestRead.Return_ == nil {
+		return nil, errors.New("пустой ответ ServiceRequestRead")
+	}
 
-	r, err := serviceRequestAdd.Return_.GetResult()
+	table, err := serviceRequestRead.Return_.GetResult()
 	if err != nil {
 		return
 	}
 
-	content = make(map[string]string)
-	for _, v := range r {
-		content[v.Name] = v.Value.Text
+	column := slices.IndexFunc(table.Column, func(c PropertyValueTableColumn) bool {
+		return c.Name == "ServiceRequestID"
+	})
+	if column == -1 && len(table.Row) != 0 {
+		return nil, errors.New("в ответе ServiceRequestRead нет колонки ServiceRequestID")
+	}
+
+	for _, row := range table.Row {
+		if column >= len(row.Value) {
+			return nil, errors.New("в ответе ServiceRequestRead нет значения ServiceRequestID")
+		}
+		id, err := uuid.Parse(row.Value[column].Text)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный ServiceRequestID в ответе ServiceRequestRead: %w", err)
+		}
+		ids = append(ids, id)
 	}
 
 	return
 }
 
+// Добавить сообщение в заявку от имени пользователя
+func AddTicketMessage(ctx context.Context, soapcl *soap.Client, ticketID, authorID uuid.UUID, text string) error {
+	service := NewPartnerWebAPI2PortType(soapcl)
+
+	r, err := service.ServiceRequestSendTextMessageContext(
+		ctx,
+		&ServiceRequestSendTextMessage{
+			ServiceRequestID: ticketID.String(),
+			AuthorID:         authorID.String(),
+			Message:          text,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if r.Return_ == nil {
+		return errors.New("пустой ответ ServiceRequestSendTextMessage")
+	}
+
+	_, err = r.Return_.GetResult()
+	return err
+}
+
+// Прикрепить файл к заявке от имени пользователя, soapcl должен быть с поддержкой MTOM
+func AttachTicketFile(ctx context.Context, soapcl *soap.Client, ticketID, authorID uuid.UUID, name string, data []byte) error {
+	service := NewPartnerWebAPI2PortType(soapcl)
+
+	r, err := service.ServiceRequestAttachFileContext(
+		ctx,
+		&ServiceRequestAttachFile{
+			ServiceRequestID: ticketID.String(),
+			AuthorID:         authorID.String(),
+			Name:             name,
+			Data:             soap.NewBinary(data),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if r.Return_ == nil {
+		return errors.New("пустой ответ ServiceRequestAttachFile")
+	}
+
+	_, err = r.Return_.GetResult()
+	return err
+}
+
 // сформировать поле для запроса
 func formProperty(name, valueType, valueText string) ParamsProperty {
 	return ParamsProperty{
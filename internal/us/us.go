@@ -1423,7 +1423,7 @@ type ServiceRequestSendTextMessage struct {
 type ServiceRequestSendTextMessageResponse struct {
 	XMLName xml.Name `xml:"http://buhphone.com/PartnerWebAPI2 ServiceRequestSendTextMessageResponse"`
 
-	Return_ *Structure `xml:"return,omitempty" json:"return,omitempty"`
+	Return_ *ParamsStructure `xml:"return,omitempty" json:"return,omitempty"`
 }
 
 type ServiceRequestEditTextMessage struct {
@@ -1519,13 +1519,15 @@ type ServiceRequestHistoryResponse struct {
 type ServiceRequestRead struct {
 	XMLName xml.Name `xml:"http://buhphone.com/PartnerWebAPI2 ServiceRequestRead"`
 
-	Params *Structure `xml:"Params,omitempty" json:"Params,omitempty"`
+	Xs string `xml:"xmlns:xs,attr,omitempty"`
+
+	Params *Params `xml:"Params,omitempty" json:"Params,omitempty"`
 }
 
 type ServiceRequestReadResponse struct {
 	XMLName xml.Name `xml:"http://buhphone.com/PartnerWebAPI2 ServiceRequestReadResponse"`
 
-	Return_ *Structure `xml:"return,omitempty" json:"return,omitempty"`
+	Return_ *ParamsTable `xml:"return,omitempty" json:"return,omitempty"`
 }
 
 type ServiceRequestStatusRead struct {
@@ -10,4 +10,7 @@ const (
 	SUCCESS    = "SUCCESS"
 	ResultCode = "ResultCode"
 	ResultData = "ResultData"
+
+	// формат значения xs:dateTime
+	DateTimeLayout = "2006-01-02T15:04:05"
 )
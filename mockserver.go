@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"connect-text-bot/internal/connect/mock"
+	"connect-text-bot/internal/logger"
+
+	"github.com/goccy/go-yaml"
+)
+
+// mockServer - запустить имитацию 1С-Коннект для локальной разработки
+func mockServer(args []string) int {
+	var (
+		data mock.Data
+
+		fs       = flag.NewFlagSet("mock", flag.ExitOnError)
+		listen   = fs.String("listen", "127.0.0.1:9002", "Usage: -listen=<host:port>")
+		dataFile = fs.String("data", "", "Usage: -data=<mock_data_file>")
+		debug    = fs.Bool("debug", false, "Print debug information on stderr")
+	)
+
+	_ = fs.Parse(args)
+
+	loggerConfig := ""
+	logger.InitLogger(*debug, &loggerConfig)
+
+	if *dataFile != "" {
+		input, err := os.ReadFile(*dataFile)
+		if err != nil {
+			logger.Warning("Не удалось открыть файл данных", err)
+			return 1
+		}
+		if err := yaml.UnmarshalWithOptions(input, &data, yaml.Strict()); err != nil {
+			logger.Warning("Не корректный файл данных", err)
+			return 1
+		}
+	}
+
+	server := mock.New(data)
+	if err := server.Start(*listen); err != nil {
+		logger.Warning(err)
+		return 1
+	}
+	defer server.Close()
+
+	logger.Info("Mock 1C-Connect started on", server.URL())
+	logger.Info("- connect_server.addr:", server.URL())
+	logger.Info("- us_server.addr:", server.URL()+mock.SoapUri)
+	logger.Info("- send event to bot: POST", server.URL()+mock.PushUri)
+	logger.Info("- bot actions: GET", server.URL()+mock.MessagesUri)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	logger.Info("Mock 1C-Connect stopped")
+	return 0
+}
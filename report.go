@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/database"
+	"connect-text-bot/internal/events"
+	"connect-text-bot/internal/logger"
+
+	"github.com/google/uuid"
+)
+
+// report - сводка по журналу событий: воронка меню, где пользователи останавливаются, непонятые команды
+func report(args []string) int {
+	var (
+		cnf = &config.Conf{}
+
+		fs         = flag.NewFlagSet("report", flag.ExitOnError)
+		configFile = fs.String("config", "./config/config.yml", "Usage: -config=<config_file>, event_log.path is used when no files are given")
+		line       = fs.String("line", "", "Usage: -line=<line_id>, only events of the line")
+		since      = fs.String("since", "", "Usage: -since=2025-01-31 or -since=24h, only events after the date or for the period")
+		top        = fs.Int("top", 10, "Usage: -top=<n>, number of unknown commands to show")
+	)
+
+	_ = fs.Parse(args)
+
+	loggerConfig := ""
+	logger.InitLogger(false, &loggerConfig)
+
+	r := events.NewReport()
+	if *line != "" {
+		lineID, err := uuid.Parse(*line)
+		if err != nil {
+			logger.Warning("Некорректный id линии", *line)
+			return 1
+		}
+		r.LineID = lineID
+	}
+	if *since != "" {
+		t, err := parseSince(*since)
+		if err != nil {
+			logger.Warning(err)
+			return 1
+		}
+		r.Since = t
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		config.GetConfig(*configFile, cnf)
+		if cnf.EventLog.Path == "" {
+			logger.Warning("Не указан event_log.path в конфиге и не переданы файлы журнала")
+			return 1
+		}
+		files = eventLogFiles(cnf.EventLog.Path)
+	}
+
+	for _, file := range files {
+		if err := addEventLog(r, file); err != nil {
+			logger.Warning("Не удалось прочитать журнал", file, err)
+			return 1
+		}
+	}
+
+	printReport(os.Stdout, r, *top)
+	return 0
+}
+
+// период вида 24h или дата 2025-01-31
+func parseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("некорректное значение since (%s)", value)
+	}
+	return t, nil
+}
+
+// текущий файл журнала и предыдущие, начиная с самого старого
+func eventLogFiles(path string) []string {
+	var files []string
+	for i := 1; ; i++ {
+		name := events.RotatedName(path, i)
+		if _, err := os.Stat(name); err != nil {
+			break
+		}
+		files = append([]string{name}, files...)
+	}
+	return append(files, path)
+}
+
+func addEventLog(r *events.Report, file string) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.AddFrom(f)
+}
+
+func printReport(out io.Writer, r *events.Report, top int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Событий: %d, с ошибками: %d, заявок: %d, подсказок найдено: %d, не найдено: %d\n", r.Events, r.Errors, r.Tickets, r.QnaHit, r.QnaMiss)
+
+	fmt.Fprintln(w, "\nПереходы в меню\tраз\tпользователей")
+	for _, c := range r.Funnel() {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", c.Name, c.Count, c.Users)
+	}
+
+	fmt.Fprintln(w, "\nНажатия кнопок (меню: кнопка)\tраз")
+	for _, c := range r.Buttons() {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Count)
+	}
+
+	fmt.Fprintln(w, "\nГде остановились пользователи\tпользователей")
+	for _, c := range r.DropOffs(database.GREETINGS) {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Count)
+	}
+
+	fmt.Fprintln(w, "\nНепонятые команды\tраз")
+	for _, c := range r.TopUnknown(top) {
+		fmt.Fprintf(w, "%s\t%d\n", c.Name, c.Count)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"connect-text-bot/bot"
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/connect/mock"
+	"connect-text-bot/internal/events"
+	"connect-text-bot/internal/logger"
+)
+
+// simulate - прогнать сценарий бота локально, без подключения к 1С-Коннект
+func simulate(args []string) int {
+	var (
+		cnf = &config.Conf{FilesDir: "./"}
+
+		fs         = flag.NewFlagSet("simulate", flag.ExitOnError)
+		configFile = fs.String("config", "", "Usage: -config=<config_file>")
+		botConfig  = fs.String("bot", "./config/bot.yml", "Usage: -bot=<botConfig_file>")
+		script     = fs.String("script", "", "Usage: -script=<script_file>, by default messages are read from stdin")
+		debug      = fs.Bool("debug", false, "Print debug information on stderr")
+	)
+
+	_ = fs.Parse(args)
+
+	loggerConfig := ""
+	logger.InitLogger(*debug, &loggerConfig)
+
+	if *configFile != "" {
+		config.GetConfig(*configFile, cnf)
+	}
+
+	// журнал событий ведется, если он настроен в конфиге
+	if err := events.Init(cnf.EventLog); err != nil {
+		logger.Warning("Ошибка открытия журнала событий", err)
+		return 1
+	}
+	defer events.Close()
+	cnf.BotConfig = *botConfig
+
+	var in io.Reader = os.Stdin
+	if *script != "" {
+		f, err := os.Open(*script)
+		if err != nil {
+			logger.Warning("Не удалось открыть сценарий", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	menu := botconfig_parser.InitLevels(cnf.BotConfig)
+
+	sim, err := bot.NewSimulator(cnf, menu, mock.Data{})
+	if err != nil {
+		logger.Warning(err)
+		return 1
+	}
+	defer sim.Close()
+
+	if err := sim.Run(in, os.Stdout); err != nil {
+		logger.Warning(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"connect-text-bot/bot"
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/logger"
+)
+
+// testTranscripts - проверить меню бота по записанным диалогам
+func testTranscripts(args []string) int {
+	var (
+		cnf = &config.Conf{FilesDir: "./"}
+
+		fs         = flag.NewFlagSet("test", flag.ExitOnError)
+		configFile = fs.String("config", "", "Usage: -config=<config_file>")
+		botConfig  = fs.String("bot", "./config/bot.yml", "Usage: -bot=<botConfig_file>")
+		debug      = fs.Bool("debug", false, "Print debug information on stderr")
+	)
+
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: connect-text-bot test [flags] <transcript.yml | dir>...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	loggerConfig := ""
+	logger.InitLogger(*debug, &loggerConfig)
+
+	if *configFile != "" {
+		config.GetConfig(*configFile, cnf)
+	}
+	cnf.BotConfig = *botConfig
+
+	files, err := transcriptFiles(fs.Args())
+	if err != nil {
+		logger.Warning(err)
+		return 1
+	}
+	if len(files) == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	menu := botconfig_parser.InitLevels(cnf.BotConfig)
+
+	failed := 0
+	for _, file := range files {
+		t, err := bot.LoadTranscript(file)
+		if err != nil {
+			fmt.Printf("FAIL %s\n\t%s\n", file, err)
+			failed++
+			continue
+		}
+
+		divergences, err := bot.RunTranscript(cnf, menu, t)
+		if err != nil {
+			divergences = append(divergences, err.Error())
+		}
+
+		if len(divergences) != 0 {
+			fmt.Printf("FAIL %s %s\n", file, t.Name)
+			for _, d := range divergences {
+				fmt.Printf("\t%s\n", d)
+			}
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s %s\n", file, t.Name)
+	}
+
+	fmt.Printf("Сценариев: %d, с ошибками: %d\n", len(files), failed)
+	if failed != 0 {
+		return 1
+	}
+	return 0
+}
+
+// собрать файлы сценариев, для папок берутся все *.yml и *.yaml файлы
+func transcriptFiles(args []string) (files []string, err error) {
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(path); !info.IsDir() && (ext == ".yml" || ext == ".yaml") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"connect-text-bot/bot"
+	"connect-text-bot/internal/botconfig_parser"
+	"connect-text-bot/internal/config"
+	"connect-text-bot/internal/logger"
+)
+
+// диалоги из tests/ прогоняются по примеру конфига бота
+func TestSampleTranscripts(t *testing.T) {
+	loggerConfig := ""
+	logger.InitLogger(false, &loggerConfig)
+
+	cnf := &config.Conf{FilesDir: "./", BotConfig: "./config/bot.yml.sample"}
+	menu := botconfig_parser.InitLevels(cnf.BotConfig)
+
+	files, err := transcriptFiles([]string{"./tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("нет файлов диалогов в tests/")
+	}
+
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			transcript, err := bot.LoadTranscript(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			divergences, err := bot.RunTranscript(cnf, menu, transcript)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range divergences {
+				t.Error(d)
+			}
+		})
+	}
+}